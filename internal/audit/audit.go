@@ -0,0 +1,318 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultMaxSize       = 100
+	DefaultMaxBackups    = 10
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultBlockTimeout  = 5 * time.Second
+
+	// queueSize bounds the records waiting to be written, once it's full
+	// records are dropped or the responses wait for room, see Config.OnFull.
+	// Drops are counted and logged at the next flush
+	queueSize = 10000
+)
+
+// Record is what the responder asserted in a signed response
+type Record struct {
+	Time         time.Time `json:"time"`
+	Serial       string    `json:"serial"`
+	Issuer       string    `json:"issuer"`
+	Status       string    `json:"status"`
+	Reason       *int      `json:"reason,omitempty"`
+	ThisUpdate   time.Time `json:"this_update"`
+	NextUpdate   time.Time `json:"next_update"`
+	ClientIP     string    `json:"client_ip"`
+	ResponseHash string    `json:"response_sha256"`
+	RequestID    string    `json:"request_id,omitempty"`
+}
+
+// Query selects audit records, zero values match all
+type Query struct {
+	Serial string
+	Issuer string
+	Status string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// Matches reports whether a record is selected by the query
+func (q Query) Matches(r Record) bool {
+	switch {
+	case q.Serial != "" && r.Serial != q.Serial:
+		return false
+	case q.Issuer != "" && !strings.EqualFold(r.Issuer, q.Issuer):
+		return false
+	case q.Status != "" && r.Status != q.Status:
+		return false
+	case !q.From.IsZero() && r.Time.Before(q.From):
+		return false
+	case !q.To.IsZero() && !r.Time.Before(q.To):
+		return false
+	}
+	return true
+}
+
+// Sink stores batches of records
+type Sink interface {
+	Write(ctx context.Context, records []Record) error
+	Close() error
+}
+
+// Store is the database the db sink writes to
+type Store interface {
+	InsertAuditRecords(ctx context.Context, records []Record) error
+}
+
+// Config selects the sink, none, file or db. MaxSize is in megabytes.
+// OnFull is what happens to a record once the queue is full: drop, the
+// default, keeps the latency of the responses, block makes the response
+// wait up to BlockTimeout for room and only drops the record after that
+type Config struct {
+	Sink          string
+	File          string
+	MaxSize       int
+	MaxBackups    int
+	BatchSize     int
+	FlushInterval time.Duration
+	OnFull        string
+	BlockTimeout  time.Duration
+}
+
+// Validate checks the sink and the behaviour once the queue is full
+func (c Config) Validate() error {
+	switch strings.ToLower(c.Sink) {
+	case "", "none", "file", "db":
+	default:
+		return fmt.Errorf("unsupported audit sink %s, use none, file or db", c.Sink)
+	}
+	switch strings.ToLower(c.OnFull) {
+	case "", "drop", "block":
+	default:
+		return fmt.Errorf("unsupported audit queue policy %s, use drop or block", c.OnFull)
+	}
+	return nil
+}
+
+// Enabled reports whether responses are audited
+func (c Config) Enabled() bool {
+	return c.Sink != "" && !strings.EqualFold(c.Sink, "none")
+}
+
+// InDatabase reports whether records are written to the db sink
+func (c Config) InDatabase() bool {
+	return strings.EqualFold(c.Sink, "db")
+}
+
+// New returns a logger for the sink in the config, store returns the
+// database once connected and is only used by the db sink
+func New(cfg Config, store func() Store) (*Logger, error) {
+	var sink Sink
+	switch strings.ToLower(cfg.Sink) {
+	case "file":
+		maxSize := cfg.MaxSize
+		if maxSize <= 0 {
+			maxSize = DefaultMaxSize
+		}
+		fileSink, err := NewFileSink(cfg.File, int64(maxSize)<<20, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		sink = fileSink
+	case "db":
+		sink = &DBSink{store: store}
+	default:
+		return nil, fmt.Errorf("unsupported audit sink %s, use none, file or db", cfg.Sink)
+	}
+	return NewLogger(sink, cfg), nil
+}
+
+// Logger writes records in batches from a background goroutine, so that
+// auditing doesn't add to the latency of the responses
+type Logger struct {
+	sink         Sink
+	queue        chan Record
+	batchSize    int
+	interval     time.Duration
+	block        bool
+	blockTimeout time.Duration
+	dropped      atomic.Uint64
+	total        atomic.Uint64
+	failure      atomic.Pointer[string]
+	done         chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewLogger returns a logger writing to sink, the sink and file settings
+// of cfg are ignored
+func NewLogger(sink Sink, cfg Config) *Logger {
+	l := &Logger{
+		sink:         sink,
+		queue:        make(chan Record, queueSize),
+		batchSize:    cfg.BatchSize,
+		interval:     cfg.FlushInterval,
+		block:        strings.EqualFold(cfg.OnFull, "block"),
+		blockTimeout: cfg.BlockTimeout,
+		done:         make(chan struct{}),
+	}
+	if l.batchSize <= 0 {
+		l.batchSize = DefaultBatchSize
+	}
+	if l.interval <= 0 {
+		l.interval = DefaultFlushInterval
+	}
+	if l.blockTimeout <= 0 {
+		l.blockTimeout = DefaultBlockTimeout
+	}
+	go l.run()
+	return l
+}
+
+// Log queues a record. Once the queue is full it drops the record or, if
+// the logger blocks, waits for room until the block timeout
+func (l *Logger) Log(r Record) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		l.drop()
+		return
+	}
+
+	select {
+	case l.queue <- r:
+		return
+	default:
+	}
+	if !l.block {
+		l.drop()
+		return
+	}
+
+	timer := time.NewTimer(l.blockTimeout)
+	defer timer.Stop()
+	select {
+	case l.queue <- r:
+	case <-timer.C:
+		l.drop()
+	}
+}
+
+func (l *Logger) drop() {
+	l.dropped.Add(1)
+	l.total.Add(1)
+}
+
+// Dropped returns the number of records dropped since the logger started
+func (l *Logger) Dropped() uint64 {
+	return l.total.Load()
+}
+
+// Failure describes why records have been lost since the last batch was
+// written without drops, it's empty while auditing works
+func (l *Logger) Failure() string {
+	if failure := l.failure.Load(); failure != nil {
+		return *failure
+	}
+	return ""
+}
+
+func (l *Logger) setFailure(failure string) {
+	l.failure.Store(&failure)
+}
+
+// Close writes the queued records and closes the sink
+func (l *Logger) Close(ctx context.Context) error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.queue)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		return fmt.Errorf("could not write the queued audit records: %v", ctx.Err())
+	}
+	return l.sink.Close()
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	batch := make([]Record, 0, l.batchSize)
+	for {
+		select {
+		case r, ok := <-l.queue:
+			if !ok {
+				l.flush(batch)
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) >= l.batchSize {
+				l.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			l.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush writes a batch. A failure is kept until a later batch is written
+// without drops, flushes of an empty batch don't clear it
+func (l *Logger) flush(batch []Record) {
+	dropped := l.dropped.Swap(0)
+	if dropped > 0 {
+		slog.Warn("the audit queue is full, records have been dropped", "records", dropped)
+		l.setFailure(fmt.Sprintf("%d audit records have been dropped, the queue was full", dropped))
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := l.sink.Write(ctx, batch); err != nil {
+		slog.Error("could not write audit records", "records", len(batch), "reason", err)
+		l.setFailure(fmt.Sprintf("could not write %d audit records: %v", len(batch), err))
+		return
+	}
+	if dropped == 0 {
+		l.setFailure("")
+	}
+}
+
+// DBSink writes records to the ocsp_response_audit table
+type DBSink struct {
+	store func() Store
+}
+
+func (s *DBSink) Write(ctx context.Context, records []Record) error {
+	store := s.store()
+	if store == nil {
+		return fmt.Errorf("the responder is not connected with the database")
+	}
+	return store.InsertAuditRecords(ctx, records)
+}
+
+func (s *DBSink) Close() error {
+	return nil
+}
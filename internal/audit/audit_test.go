@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink keeps the records written, failing while err is set and
+// waiting while blocked is open. observe is called before every write
+type memorySink struct {
+	mu      sync.Mutex
+	records []Record
+	err     error
+	blocked chan struct{}
+	observe func()
+}
+
+func (s *memorySink) Write(ctx context.Context, records []Record) error {
+	if s.blocked != nil {
+		<-s.blocked
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.observe != nil {
+		s.observe()
+	}
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func (s *memorySink) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// waitFor polls cond until it holds or a few seconds have passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "defaults", cfg: Config{}},
+		{name: "file sink blocking", cfg: Config{Sink: "file", OnFull: "block"}},
+		{name: "db sink dropping", cfg: Config{Sink: "DB", OnFull: "drop"}},
+		{name: "unsupported sink", cfg: Config{Sink: "syslog"}, wantErr: true},
+		{name: "unsupported queue policy", cfg: Config{Sink: "file", OnFull: "wait"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoggerFailure(t *testing.T) {
+	sink := &memorySink{err: errors.New("disk full")}
+	l := NewLogger(sink, Config{FlushInterval: time.Millisecond})
+	defer l.Close(context.Background())
+
+	l.Log(Record{Serial: "1"})
+	waitFor(t, "the write failure", func() bool { return l.Failure() != "" })
+
+	// an empty flush doesn't clear the failure
+	time.Sleep(10 * time.Millisecond)
+	if l.Failure() == "" {
+		t.Fatal("the failure has been cleared without a successful write")
+	}
+
+	sink.setErr(nil)
+	l.Log(Record{Serial: "2"})
+	waitFor(t, "the failure to clear", func() bool { return l.Failure() == "" })
+}
+
+func TestLoggerDrops(t *testing.T) {
+	tests := []struct {
+		name   string
+		onFull string
+	}{
+		{name: "drop", onFull: "drop"},
+		{name: "block until the timeout", onFull: "block"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memorySink{blocked: make(chan struct{})}
+			l := NewLogger(sink, Config{BatchSize: 1, OnFull: tt.onFull, BlockTimeout: time.Millisecond})
+			// the failure is reported by the batch flushed after the drop and
+			// cleared by the next one
+			reported := false
+			sink.observe = func() {
+				if l.Failure() != "" {
+					reported = true
+				}
+			}
+
+			// the first record is held by the blocked sink, then the queue fills
+			l.Log(Record{Serial: "first"})
+			waitFor(t, "the first record to be taken", func() bool { return len(l.queue) == 0 })
+			for i := 0; i < queueSize; i++ {
+				l.Log(Record{Serial: "queued"})
+			}
+			start := time.Now()
+			l.Log(Record{Serial: "dropped"})
+			if tt.onFull == "block" && time.Since(start) < time.Millisecond {
+				t.Error("Log returned before the block timeout")
+			}
+			if l.Dropped() != 1 {
+				t.Fatalf("Dropped() = %d, want 1", l.Dropped())
+			}
+
+			close(sink.blocked)
+			if err := l.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if !reported {
+				t.Error("the drop hasn't been reported as a failure")
+			}
+			if l.Failure() != "" {
+				t.Errorf("Failure() = %q after later batches have been written", l.Failure())
+			}
+			if len(sink.records) != queueSize+1 {
+				t.Errorf("%d records have been written, want %d", len(sink.records), queueSize+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+)
+
+// FileSink writes records as JSON lines. Once the file would grow past
+// maxSize it's renamed to path.1, path.1 to path.2 and so on, keeping
+// maxBackups old files
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	if path == "" {
+		return nil, errors.New("the audit file path is required")
+	}
+	s := FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open audit file: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) Write(ctx context.Context, records []Record) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	if s.size > 0 && s.size+int64(buf.Len()) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(buf.Bytes())
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	// records are evidence, make sure they survive a crash
+	return s.file.Sync()
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	if s.maxBackups <= 0 {
+		if err := os.Remove(s.path); err != nil {
+			return err
+		}
+		return s.open()
+	}
+
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backupName(s.path, i), backupName(s.path, i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(s.path, backupName(s.path, 1)); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// SearchFile returns the records matching the query from the audit file
+// and its backups, newest first so the limit keeps the latest ones
+func SearchFile(path string, q Query) ([]Record, error) {
+	files := []string{path}
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backupName(path, i)); err != nil {
+			break
+		}
+		files = append(files, backupName(path, i))
+	}
+
+	records := []Record{}
+	for _, name := range files {
+		matches, err := searchFile(name, q)
+		if err != nil {
+			return nil, err
+		}
+		slices.Reverse(matches)
+		records = append(records, matches...)
+		if q.Limit > 0 && len(records) >= q.Limit {
+			return records[:q.Limit], nil
+		}
+	}
+	return records, nil
+}
+
+// searchFile returns the records of a file matching the query, in the order
+// they were written
+func searchFile(name string, q Query) ([]Record, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := []Record{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("could not read %s line %d: %v", name, line, err)
+		}
+		if q.Matches(r) {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
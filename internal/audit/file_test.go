@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFileSinkRotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxBackups  int
+		wantFiles   []string
+		wantSerials []string
+	}{
+		{
+			name:        "keeps backups",
+			maxBackups:  2,
+			wantFiles:   []string{"audit.log", "audit.log.1", "audit.log.2"},
+			wantSerials: []string{"4", "3", "2"},
+		},
+		{
+			name:        "no backups",
+			maxBackups:  0,
+			wantFiles:   []string{"audit.log"},
+			wantSerials: []string{"4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "audit.log")
+			// every record is larger than half the file, so each write rotates
+			s, err := NewFileSink(path, 150, tt.maxBackups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 5; i++ {
+				if err := s.Write(context.Background(), []Record{{Serial: fmt.Sprint(i), Status: "good"}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files := []string{}
+			for _, e := range entries {
+				files = append(files, e.Name())
+			}
+			if !slices.Equal(files, tt.wantFiles) {
+				t.Errorf("files = %v, want %v", files, tt.wantFiles)
+			}
+
+			records, err := SearchFile(path, Query{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			serials := []string{}
+			for _, r := range records {
+				serials = append(serials, r.Serial)
+			}
+			if !slices.Equal(serials[:len(tt.wantSerials)], tt.wantSerials) || len(serials) != len(tt.wantFiles) {
+				t.Errorf("serials = %v, want the last %d newest first %v", serials, len(tt.wantFiles), tt.wantSerials)
+			}
+		})
+	}
+}
+
+func TestSearchFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	s, err := NewFileSink(path, 1<<20, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	statuses := []string{"good", "revoked"}
+	// two files of three records, the oldest in the backup
+	for i := 0; i < 6; i++ {
+		if i == 3 {
+			if err := s.rotate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r := Record{Time: start.Add(time.Duration(i) * time.Hour), Serial: fmt.Sprint(i), Status: statuses[i%2], Issuer: "CN=CA"}
+		if err := s.Write(context.Background(), []Record{r}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{name: "all newest first", query: Query{}, want: []string{"5", "4", "3", "2", "1", "0"}},
+		{name: "limit keeps the newest", query: Query{Limit: 2}, want: []string{"5", "4"}},
+		{name: "limit across files", query: Query{Limit: 4}, want: []string{"5", "4", "3", "2"}},
+		{name: "status", query: Query{Status: "revoked"}, want: []string{"5", "3", "1"}},
+		{name: "serial", query: Query{Serial: "1"}, want: []string{"1"}},
+		{name: "issuer ignores case", query: Query{Issuer: "cn=ca", Limit: 1}, want: []string{"5"}},
+		{name: "time range", query: Query{From: start.Add(2 * time.Hour), To: start.Add(4 * time.Hour)}, want: []string{"3", "2"}},
+		{name: "no match", query: Query{Serial: "42"}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := SearchFile(path, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, r := range records {
+				got = append(got, r.Serial)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("SearchFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
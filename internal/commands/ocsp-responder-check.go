@@ -0,0 +1,418 @@
+package commands
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/scncore/scncore-ocsp-responder/internal/models"
+	"github.com/scncore/scncore-ocsp-responder/internal/server/handler"
+	"github.com/scncore/utils"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ocsp"
+)
+
+// Exit codes of the check command, they follow the monitoring plugins
+// convention so check can be used as a Nagios or Icinga check
+const (
+	checkOK       = 0
+	checkWarning  = 1
+	checkCritical = 2
+	checkUnknown  = 3
+)
+
+var oidNonce = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+
+// CheckResult is what the responder asserted for a certificate
+type CheckResult struct {
+	URL        string    `json:"url"`
+	Serial     string    `json:"serial"`
+	Status     string    `json:"status,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	RevokedAt  time.Time `json:"revoked_at,omitzero"`
+	ProducedAt time.Time `json:"produced_at,omitzero"`
+	ThisUpdate time.Time `json:"this_update,omitzero"`
+	NextUpdate time.Time `json:"next_update,omitzero"`
+	Responder  string    `json:"responder,omitempty"`
+	Nonce      string    `json:"nonce"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func CheckOCSPResponder() *cli.Command {
+	return &cli.Command{
+		Name:  "check",
+		Usage: "Ask an OCSP responder for the status of a certificate",
+		Description: "Exits with 0 if the certificate is good, 1 if its status is unknown, 2 if it has been revoked,\n" +
+			"the response is stale or the nonce doesn't match, and 3 if no valid response could be obtained",
+		Action: checkOCSPResponder,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "cert",
+				Usage: "the path to the PEM certificate to check",
+			},
+			&cli.StringFlag{
+				Name:  "serial",
+				Usage: "the serial number of the certificate to check instead of --cert, decimal or hexadecimal prefixed with 0x",
+			},
+			&cli.StringFlag{
+				Name:     "issuer",
+				Usage:    "the path to the PEM certificate of the CA that issued the certificate",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "url",
+				Usage: "the URL of the OCSP responder, defaults to the one in the certificate",
+			},
+			&cli.StringFlag{
+				Name:  "method",
+				Usage: "the HTTP method used to send the request (GET or POST)",
+				Value: "POST",
+			},
+			&cli.StringFlag{
+				Name:  "hash",
+				Usage: "the hash used to identify the issuer (sha1 or sha256)",
+				Value: "sha1",
+			},
+			&cli.BoolFlag{
+				Name:  "nonce",
+				Usage: "add a nonce to the request and check that the response carries it back",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "the deadline for the responder to answer",
+				Value: 10 * time.Second,
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the result as JSON",
+			},
+		},
+	}
+}
+
+func checkOCSPResponder(cCtx *cli.Context) error {
+	result, code := checkCertificate(cCtx)
+
+	if cCtx.Bool("json") {
+		if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
+			return err
+		}
+	} else {
+		printCheckResult(result)
+	}
+
+	if code != checkOK {
+		return cli.Exit("", code)
+	}
+	return nil
+}
+
+func checkCertificate(cCtx *cli.Context) (CheckResult, int) {
+	result := CheckResult{URL: cCtx.String("url"), Nonce: "not requested"}
+	fail := func(err error) (CheckResult, int) {
+		result.Error = err.Error()
+		return result, checkUnknown
+	}
+
+	issuer, err := utils.ReadPEMCertificate(cCtx.String("issuer"))
+	if err != nil {
+		return fail(fmt.Errorf("could not read the issuer certificate: %v", err))
+	}
+
+	var cert *x509.Certificate
+	switch {
+	case cCtx.String("cert") != "" && cCtx.String("serial") != "":
+		return fail(errors.New("use either --cert or --serial"))
+	case cCtx.String("cert") != "":
+		cert, err = utils.ReadPEMCertificate(cCtx.String("cert"))
+		if err != nil {
+			return fail(fmt.Errorf("could not read the certificate: %v", err))
+		}
+		if result.URL == "" && len(cert.OCSPServer) > 0 {
+			result.URL = cert.OCSPServer[0]
+		}
+	case cCtx.String("serial") != "":
+		serial, err := handler.ParseSerial(cCtx.String("serial"))
+		if err != nil {
+			return fail(err)
+		}
+		// only the serial number is used to build the request
+		cert = &x509.Certificate{SerialNumber: serial}
+	default:
+		return fail(errors.New("either --cert or --serial is required"))
+	}
+	result.Serial = cert.SerialNumber.String()
+	if result.URL == "" {
+		return fail(errors.New("--url is required as the certificate doesn't include an OCSP server"))
+	}
+
+	var hash crypto.Hash
+	switch strings.ToLower(cCtx.String("hash")) {
+	case "sha1":
+		hash = crypto.SHA1
+	case "sha256":
+		hash = crypto.SHA256
+	default:
+		return fail(fmt.Errorf("unsupported hash %s, use sha1 or sha256", cCtx.String("hash")))
+	}
+
+	request, err := ocsp.CreateRequest(cert, issuer, &ocsp.RequestOptions{Hash: hash})
+	if err != nil {
+		return fail(fmt.Errorf("could not create the OCSP request: %v", err))
+	}
+
+	var nonce []byte
+	if cCtx.Bool("nonce") {
+		request, nonce, err = addNonce(request)
+		if err != nil {
+			return fail(fmt.Errorf("could not add a nonce to the OCSP request: %v", err))
+		}
+	}
+
+	der, err := sendOCSPRequest(result.URL, cCtx.String("method"), request, cCtx.Duration("timeout"))
+	if err != nil {
+		return fail(err)
+	}
+
+	// the signature and, if included, the responder certificate are
+	// verified against the issuer
+	response, err := ocsp.ParseResponseForCert(der, cert, issuer)
+	if err != nil {
+		return fail(fmt.Errorf("invalid OCSP response: %v", err))
+	}
+	if err := verifyResponderCertificate(response, issuer); err != nil {
+		return fail(err)
+	}
+
+	result.ProducedAt = response.ProducedAt
+	result.ThisUpdate = response.ThisUpdate
+	result.NextUpdate = response.NextUpdate
+	result.Responder = issuer.Subject.String()
+	if response.Certificate != nil {
+		result.Responder = response.Certificate.Subject.String()
+	}
+
+	code := checkOK
+	switch response.Status {
+	case ocsp.Good:
+		result.Status = "good"
+	case ocsp.Revoked:
+		result.Status = "revoked"
+		result.Reason = models.ReasonName(response.RevocationReason)
+		result.RevokedAt = response.RevokedAt
+		code = checkCritical
+	default:
+		result.Status = "unknown"
+		code = checkWarning
+	}
+
+	if nonce != nil {
+		echoed, err := responseNonce(der, response)
+		switch {
+		case err != nil:
+			return fail(fmt.Errorf("could not read the nonce of the response: %v", err))
+		case echoed == nil:
+			result.Nonce = "absent"
+		case bytes.Equal(echoed, nonce):
+			result.Nonce = "match"
+		default:
+			result.Nonce = "mismatch"
+			result.Error = "the response nonce doesn't match the request, it may be replayed"
+			code = checkCritical
+		}
+	}
+
+	if !response.NextUpdate.IsZero() && response.NextUpdate.Before(time.Now()) {
+		result.Error = "the response is stale, its next update is in the past"
+		code = checkCritical
+	}
+
+	return result, code
+}
+
+func sendOCSPRequest(responderURL string, method string, request []byte, timeout time.Duration) ([]byte, error) {
+	var req *http.Request
+	var err error
+	switch strings.ToUpper(method) {
+	case http.MethodGet:
+		encoded := url.PathEscape(base64.StdEncoding.EncodeToString(request))
+		req, err = http.NewRequest(http.MethodGet, strings.TrimSuffix(responderURL, "/")+"/"+encoded, nil)
+	case http.MethodPost:
+		req, err = http.NewRequest(http.MethodPost, responderURL, bytes.NewReader(request))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/ocsp-request")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported method %s, use GET or POST", method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/ocsp-response")
+
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach the OCSP responder: %v", err)
+	}
+	defer resp.Body.Close()
+
+	der, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("could not read the OCSP response: %v", err)
+	}
+
+	// error responses are DER too, let the parser report their status
+	if resp.StatusCode != http.StatusOK && !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/ocsp-response") {
+		return nil, fmt.Errorf("the OCSP responder answered %s", resp.Status)
+	}
+	return der, nil
+}
+
+// verifyResponderCertificate checks that a delegated responder certificate
+// is valid and allowed to sign OCSP responses, the parser has already
+// checked that the issuer signed it
+func verifyResponderCertificate(response *ocsp.Response, issuer *x509.Certificate) error {
+	cert := response.Certificate
+	if cert == nil || bytes.Equal(cert.Raw, issuer.Raw) {
+		return nil
+	}
+
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("the responder certificate %s is not valid at this time", cert.Subject)
+	}
+	if !slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageOCSPSigning) {
+		return fmt.Errorf("the responder certificate %s is not allowed to sign OCSP responses", cert.Subject)
+	}
+	// without it clients have to check the revocation of the responder
+	// certificate itself
+	if !slices.ContainsFunc(cert.Extensions, func(e pkix.Extension) bool { return e.Id.Equal(oidOCSPNoCheck) }) {
+		return fmt.Errorf("the responder certificate %s lacks id-pkix-ocsp-nocheck", cert.Subject)
+	}
+	return nil
+}
+
+func printCheckResult(r CheckResult) {
+	fmt.Printf("URL:          %s\n", r.URL)
+	fmt.Printf("Serial:       %s\n", r.Serial)
+	if r.Status != "" {
+		status := r.Status
+		if r.Reason != "" {
+			status = fmt.Sprintf("%s (%s)", r.Status, r.Reason)
+		}
+		fmt.Printf("Status:       %s\n", status)
+		if !r.RevokedAt.IsZero() {
+			fmt.Printf("Revoked at:   %s\n", r.RevokedAt.Format(time.RFC3339))
+		}
+		fmt.Printf("Produced at:  %s\n", r.ProducedAt.Format(time.RFC3339))
+		fmt.Printf("This update:  %s\n", r.ThisUpdate.Format(time.RFC3339))
+		if !r.NextUpdate.IsZero() {
+			fmt.Printf("Next update:  %s\n", r.NextUpdate.Format(time.RFC3339))
+		}
+		fmt.Printf("Responder:    %s\n", r.Responder)
+		fmt.Printf("Nonce:        %s\n", r.Nonce)
+	}
+	if r.Error != "" {
+		fmt.Printf("Error:        %s\n", r.Error)
+	}
+}
+
+// ASN.1 structures of RFC 6960 needed to handle nonces, which the ocsp
+// package doesn't support
+type ocspRequestASN1 struct {
+	TBSRequest        tbsRequestASN1
+	OptionalSignature asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type tbsRequestASN1 struct {
+	Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+	RequestList   []asn1.RawValue
+	Extensions    []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+type ocspResponseASN1 struct {
+	Status        asn1.Enumerated
+	ResponseBytes responseBytesASN1 `asn1:"explicit,tag:0,optional"`
+}
+
+type responseBytesASN1 struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type basicResponseASN1 struct {
+	TBSResponseData    tbsResponseDataASN1
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type tbsResponseDataASN1 struct {
+	Version            int `asn1:"explicit,tag:0,default:0,optional"`
+	RawResponderID     asn1.RawValue
+	ProducedAt         time.Time `asn1:"generalized"`
+	Responses          []asn1.RawValue
+	ResponseExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+// addNonce adds a random nonce extension (RFC 8954) to a request
+func addNonce(request []byte) ([]byte, []byte, error) {
+	var req ocspRequestASN1
+	if _, err := asn1.Unmarshal(request, &req); err != nil {
+		return nil, nil, err
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, nil, err
+	}
+	nonce, err := asn1.Marshal(random)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.TBSRequest.Extensions = append(req.TBSRequest.Extensions, pkix.Extension{Id: oidNonce, Value: nonce})
+	request, err = asn1.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return request, nonce, nil
+}
+
+// responseNonce returns the nonce extension of a response, from the
+// response extensions or, for some responders, the single extensions
+func responseNonce(der []byte, response *ocsp.Response) ([]byte, error) {
+	var resp ocspResponseASN1
+	if _, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, err
+	}
+	var basic basicResponseASN1
+	if _, err := asn1.Unmarshal(resp.ResponseBytes.Response, &basic); err != nil {
+		return nil, err
+	}
+
+	for _, extensions := range [][]pkix.Extension{basic.TBSResponseData.ResponseExtensions, response.Extensions} {
+		for _, ext := range extensions {
+			if ext.Id.Equal(oidNonce) {
+				return ext.Value, nil
+			}
+		}
+	}
+	return nil, nil
+}
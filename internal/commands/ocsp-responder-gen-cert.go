@@ -0,0 +1,254 @@
+package commands
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/scncore/scncore-ocsp-responder/internal/common"
+	"github.com/scncore/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// oidOCSPNoCheck is id-pkix-ocsp-nocheck, it tells clients not to check
+// the revocation of the responder certificate (RFC 6960 section 4.2.2.2.1)
+var oidOCSPNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+
+func GenResponderCertOCSPResponder() *cli.Command {
+	return &cli.Command{
+		Name:  "gen-responder-cert",
+		Usage: "Issue a delegated OCSP signing certificate and key for the responder",
+		Description: "The certificate has the OCSPSigning extended key usage and the id-pkix-ocsp-nocheck extension,\n" +
+			"so keep its lifetime short. Files are written where start reads them by default",
+		Action: genResponderCert,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "cacert",
+				Value:   "certificates/ca.cer",
+				Usage:   "the path to your CA certificate file in PEM format",
+				EnvVars: []string{"CA_CERT_FILENAME"},
+			},
+			&cli.StringFlag{
+				Name:    "cakey",
+				Value:   "certificates/ca.key",
+				Usage:   "the path to your CA private key file in PEM format",
+				EnvVars: []string{"CA_KEY_FILENAME"},
+			},
+			&cli.StringFlag{
+				Name:    "cert",
+				Value:   "certificates/ocsp.cer",
+				Usage:   "the path where the OCSP server certificate is written",
+				EnvVars: []string{"SERVER_CERT_FILENAME"},
+			},
+			&cli.StringFlag{
+				Name:    "key",
+				Value:   "certificates/ocsp.key",
+				Usage:   "the path where the OCSP server private key is written",
+				EnvVars: []string{"SERVER_KEY_FILENAME"},
+			},
+			&cli.StringFlag{
+				Name:  "key-type",
+				Usage: "the type of key generated (rsa or ecdsa)",
+				Value: "rsa",
+			},
+			&cli.IntFlag{
+				Name:  "rsa-bits",
+				Usage: "the size of RSA keys",
+				Value: 3072,
+			},
+			&cli.StringFlag{
+				Name:  "curve",
+				Usage: "the curve of ECDSA keys (P-256 or P-384)",
+				Value: "P-256",
+			},
+			&cli.DurationFlag{
+				Name:  "lifetime",
+				Usage: "how long the certificate is valid, it can't outlive the CA certificate",
+				Value: 90 * 24 * time.Hour,
+			},
+			&cli.StringFlag{
+				Name:  "common-name",
+				Usage: "the common name of the certificate, defaults to the CA common name followed by OCSP Responder",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "overwrite existing certificate and key files",
+			},
+		},
+	}
+}
+
+func genResponderCert(cCtx *cli.Context) error {
+	cwd, err := common.GetWd()
+	if err != nil {
+		return err
+	}
+	path := func(flag string) string {
+		if filepath.IsAbs(cCtx.String(flag)) {
+			return cCtx.String(flag)
+		}
+		return filepath.Join(cwd, cCtx.String(flag))
+	}
+	certPath, keyPath := path("cert"), path("key")
+
+	if !cCtx.Bool("force") {
+		for _, p := range []string{certPath, keyPath} {
+			if _, err := os.Stat(p); err == nil {
+				return fmt.Errorf("%s already exists, use --force to overwrite it", p)
+			}
+		}
+	}
+
+	caCert, err := utils.ReadPEMCertificate(path("cacert"))
+	if err != nil {
+		return fmt.Errorf("could not read the CA certificate, reason: %v", err)
+	}
+	caKey, err := common.ReadPrivateKey(path("cakey"))
+	if err != nil {
+		return fmt.Errorf("could not read the CA private key, reason: %v", err)
+	}
+	if pub, ok := caKey.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(caCert.PublicKey) {
+		return errors.New("the CA private key doesn't match the CA certificate")
+	}
+
+	key, err := generateKey(cCtx.String("key-type"), cCtx.Int("rsa-bits"), cCtx.String("curve"))
+	if err != nil {
+		return err
+	}
+
+	template, err := responderTemplate(cCtx, caCert, key.Public())
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, key.Public(), caKey)
+	if err != nil {
+		return fmt.Errorf("could not issue the certificate, reason: %v", err)
+	}
+
+	keyBlock, err := marshalKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certPath), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(keyBlock), 0600); err != nil {
+		return fmt.Errorf("could not write the private key, reason: %v", err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("could not write the certificate, reason: %v", err)
+	}
+
+	fmt.Printf("the OCSP signing certificate for %s has been written to %s, valid until %s\n", template.Subject, certPath, template.NotAfter.Format(time.RFC3339))
+	fmt.Printf("its private key has been written to %s\n", keyPath)
+	return nil
+}
+
+func generateKey(keyType string, bits int, curve string) (crypto.Signer, error) {
+	switch strings.ToLower(keyType) {
+	case "rsa":
+		if bits < 2048 {
+			return nil, errors.New("RSA keys must have at least 2048 bits")
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	case "ecdsa":
+		switch strings.ToUpper(curve) {
+		case "P-256", "P256":
+			return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		case "P-384", "P384":
+			return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		default:
+			return nil, fmt.Errorf("unsupported curve %s, use P-256 or P-384", curve)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %s, use rsa or ecdsa", keyType)
+	}
+}
+
+func responderTemplate(cCtx *cli.Context, caCert *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, err
+	}
+
+	spki, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(spki, &publicKeyInfo); err != nil {
+		return nil, err
+	}
+	keyID := sha1.Sum(publicKeyInfo.PublicKey.Bytes)
+
+	commonName := cCtx.String("common-name")
+	if commonName == "" {
+		commonName = strings.TrimSpace(caCert.Subject.CommonName + " OCSP Responder")
+	}
+
+	// the certificate can't be valid longer than the CA
+	notBefore := time.Now().Add(-5 * time.Minute)
+	notAfter := time.Now().Add(cCtx.Duration("lifetime"))
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+		fmt.Printf("the lifetime has been shortened as the CA certificate expires at %s\n", caCert.NotAfter.Format(time.RFC3339))
+	}
+
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: caCert.Subject.Organization,
+			Country:      caCert.Subject.Country,
+		},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		SubjectKeyId:          keyID[:],
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidOCSPNoCheck, Value: asn1.NullBytes},
+		},
+	}, nil
+}
+
+// marshalKey encodes RSA keys in PKCS #1 and EC keys in SEC 1, the formats
+// start reads
+func marshalKey(key crypto.Signer) (*pem.Block, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}, nil
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key %T", key)
+	}
+}
@@ -0,0 +1,221 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// unitTemplate is a systemd unit that runs start as a notify service, with
+// the sandboxing options an OCSP responder can live with
+var unitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=scncore OCSP Responder
+Documentation=https://datatracker.ietf.org/doc/html/rfc6960
+Wants=network-online.target
+After=network-online.target postgresql.service
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart={{.ExecStart}}
+{{- if .EnvironmentFile}}
+EnvironmentFile=-{{.EnvironmentFile}}
+{{- end}}
+User={{.User}}
+Group={{.Group}}
+RuntimeDirectory=scncore-ocsp-responder
+RuntimeDirectoryMode=0750
+Restart=on-failure
+RestartSec=5s
+# the responder is ready once it's connected with the database, which may take a while
+TimeoutStartSec={{.StartTimeout}}
+TimeoutStopSec={{.StopTimeout}}
+{{- if .Watchdog}}
+WatchdogSec={{.Watchdog}}
+{{- end}}
+
+# OCSP is usually served on port 80
+AmbientCapabilities=CAP_NET_BIND_SERVICE
+CapabilityBoundingSet=CAP_NET_BIND_SERVICE
+NoNewPrivileges=yes
+ProtectSystem=strict
+{{- range .ReadWritePaths}}
+ReadWritePaths={{.}}
+{{- end}}
+ProtectHome=yes
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectClock=yes
+ProtectHostname=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectControlGroups=yes
+ProtectProc=invisible
+ProcSubset=pid
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6
+RestrictNamespaces=yes
+RestrictRealtime=yes
+RestrictSUIDSGID=yes
+RemoveIPC=yes
+LockPersonality=yes
+MemoryDenyWriteExecute=yes
+SystemCallArchitectures=native
+SystemCallFilter=@system-service
+SystemCallFilter=~@privileged @resources
+UMask=0077
+LimitNOFILE=65536
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+type unitConfig struct {
+	ExecStart       string
+	EnvironmentFile string
+	User            string
+	Group           string
+	StartTimeout    string
+	StopTimeout     string
+	Watchdog        string
+	ReadWritePaths  []string
+}
+
+func GenSystemdUnitOCSPResponder() *cli.Command {
+	return &cli.Command{
+		Name:  "gen-systemd-unit",
+		Usage: "Write a hardened systemd unit file that runs the OCSP Responder",
+		Description: "The unit runs start as a notify service: systemd considers it started once it serves OCSP\n" +
+			"requests, shows what it's waiting for in systemctl status and restarts it if the watchdog isn't pinged",
+		Action: genSystemdUnit,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "binary",
+				Usage: "the path to the responder executable, defaults to this executable",
+			},
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "the path to the ini config file passed to start",
+			},
+			&cli.StringFlag{
+				Name:  "environment-file",
+				Usage: "an optional file with the environment variables of the responder, e.g (/etc/default/scncore-ocsp-responder)",
+			},
+			&cli.StringFlag{
+				Name:  "user",
+				Usage: "the user the responder runs as, it must be able to read the certificates and keys",
+				Value: "scncore-ocsp",
+			},
+			&cli.StringFlag{
+				Name:  "group",
+				Usage: "the group the responder runs as, defaults to --user",
+			},
+			&cli.StringSliceFlag{
+				Name:  "read-write-path",
+				Usage: "a path the responder may write to, such as the directory of the audit file, can be repeated",
+			},
+			&cli.DurationFlag{
+				Name:  "start-timeout",
+				Usage: "how long systemd waits for the responder to be ready, 0 waits forever",
+			},
+			&cli.DurationFlag{
+				Name:  "stop-timeout",
+				Usage: "how long systemd waits for the responder to stop, keep it above its shutdown timeout",
+				Value: 40 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "watchdog",
+				Usage: "how long the responder may go without pinging the watchdog before being restarted, 0 disables it",
+				Value: 30 * time.Second,
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "the path to the unit file, the unit is written to stdout if not set",
+			},
+		},
+	}
+}
+
+func genSystemdUnit(cCtx *cli.Context) error {
+	binary := cCtx.String("binary")
+	if binary == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		binary = exe
+	}
+	if !filepath.IsAbs(binary) {
+		return fmt.Errorf("systemd requires an absolute path to the executable, got %s", binary)
+	}
+
+	args := []string{binary, "start", "--pid-file", "/run/scncore-ocsp-responder/PIDFILE"}
+	if cCtx.String("config") != "" {
+		args = append(args, "--config", cCtx.String("config"))
+	}
+	for i, arg := range args {
+		args[i] = systemdQuote(arg)
+	}
+
+	unit := unitConfig{
+		ExecStart:       strings.Join(args, " "),
+		EnvironmentFile: cCtx.String("environment-file"),
+		User:            cCtx.String("user"),
+		Group:           cCtx.String("group"),
+		StartTimeout:    systemdDuration(cCtx.Duration("start-timeout")),
+		StopTimeout:     systemdDuration(cCtx.Duration("stop-timeout")),
+		ReadWritePaths:  cCtx.StringSlice("read-write-path"),
+	}
+	if unit.Group == "" {
+		unit.Group = unit.User
+	}
+	if cCtx.Duration("watchdog") > 0 {
+		unit.Watchdog = systemdDuration(cCtx.Duration("watchdog"))
+	}
+
+	out := io.Writer(os.Stdout)
+	if cCtx.String("output") != "" {
+		f, err := os.OpenFile(cCtx.String("output"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if err := unitTemplate.Execute(out, unit); err != nil {
+		return fmt.Errorf("could not write the unit file, reason: %v", err)
+	}
+
+	if cCtx.String("output") != "" {
+		fmt.Printf("the unit file has been written to %s, run systemctl daemon-reload to load it\n", cCtx.String("output"))
+	}
+	return nil
+}
+
+// systemdDuration formats d as a systemd time span, 0 means infinity
+func systemdDuration(d time.Duration) string {
+	if d <= 0 {
+		return "infinity"
+	}
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// systemdQuote escapes specifiers and quotes an ExecStart argument that
+// contains spaces or quotes
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	if !strings.ContainsAny(arg, " \t\"'\\") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/scncore/scncore-ocsp-responder/internal/common"
+	"github.com/scncore/scncore-ocsp-responder/internal/server/handler"
+	"github.com/scncore/utils"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ocsp"
+)
+
+func HealthcheckOCSPResponder() *cli.Command {
+	return &cli.Command{
+		Name:  "healthcheck",
+		Usage: "Probe the local OCSP Responder, e.g as a container health check",
+		Description: "Queries the health endpoint, then asks for the status of a canary serial and verifies the\n" +
+			"signature of the response against the CA certificate. The canary serial is random unless set.\n" +
+			"Exits with 0 if the responder is healthy and 1 otherwise",
+		Action: healthcheck,
+		Flags: []cli.Flag{
+			portFlag(),
+			urlFlag(),
+			&cli.BoolFlag{
+				Name:  "ready",
+				Usage: "probe /readyz instead of /healthz, so the responder is unhealthy while it can't reach the database",
+			},
+			&cli.BoolFlag{
+				Name:    "canary",
+				Usage:   "request the status of a canary serial to check that responses are signed, --canary=false only probes the health endpoint",
+				EnvVars: []string{"OCSP_CANARY"},
+				Value:   true,
+			},
+			&cli.StringFlag{
+				Name:    "canary-serial",
+				Usage:   "the canary serial, decimal or hexadecimal prefixed with 0x",
+				EnvVars: []string{"OCSP_CANARY_SERIAL"},
+			},
+			&cli.StringFlag{
+				Name:    "cacert",
+				Value:   "certificates/ca.cer",
+				Usage:   "the path to your CA certificate file in PEM format, used to verify the canary response",
+				EnvVars: []string{"CA_CERT_FILENAME"},
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "the deadline for each request, with the canary two requests are made",
+				Value: 2 * time.Second,
+			},
+		},
+	}
+}
+
+// portFlag and urlFlag select the local responder probed by healthcheck
+// and status
+func portFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "port",
+		Usage:   "the port used by the OCSP Responder",
+		EnvVars: []string{"OCSP_PORT"},
+		Value:   "8000",
+	}
+}
+
+func urlFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "url",
+		Usage: "the base URL of the responder instead of http://localhost:<port>, e.g (https://localhost:8443)",
+	}
+}
+
+// responderURL returns the base URL of the local responder
+func responderURL(cCtx *cli.Context) string {
+	if url := strings.TrimSuffix(cCtx.String("url"), "/"); url != "" {
+		return url
+	}
+	return "http://localhost:" + cCtx.String("port")
+}
+
+func healthcheck(cCtx *cli.Context) error {
+	baseURL := responderURL(cCtx)
+
+	path := "/healthz"
+	if cCtx.Bool("ready") {
+		path = "/readyz"
+	}
+
+	report, code, err := probeHealth(baseURL, path, cCtx.Duration("timeout"))
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("unhealthy: %v", err), 1)
+	}
+	if code != http.StatusOK {
+		return cli.Exit(fmt.Sprintf("unhealthy: %s reports %s, database %s", path, report.Status, healthLine(report.Database.Status, report.Database.Detail)), 1)
+	}
+
+	if !cCtx.Bool("canary") {
+		fmt.Printf("healthy: %s answered, the responder reports %s\n", path, report.Status)
+		return nil
+	}
+
+	status, err := canaryRoundTrip(cCtx, baseURL)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("unhealthy: the canary request failed, %v", err), 1)
+	}
+	fmt.Printf("healthy: %s answered, the canary serial is %s with a valid signature\n", path, status)
+	return nil
+}
+
+// canaryRoundTrip asks for the status of the canary serial and verifies
+// the signed response, it returns the status of the serial
+func canaryRoundTrip(cCtx *cli.Context, baseURL string) (string, error) {
+	// the path is resolved the same way as start does
+	cwd, err := common.GetWd()
+	if err != nil {
+		return "", err
+	}
+	issuer, err := utils.ReadPEMCertificate(common.ResolvePath(cwd, cCtx.String("cacert")))
+	if err != nil {
+		return "", fmt.Errorf("could not read the CA certificate: %v", err)
+	}
+
+	// unknown serials are answered as good, a random one makes the responder
+	// look it up and sign a response
+	var serial *big.Int
+	if cCtx.String("canary-serial") != "" {
+		serial, err = handler.ParseSerial(cCtx.String("canary-serial"))
+	} else {
+		serial, err = rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
+	}
+	if err != nil {
+		return "", err
+	}
+	return requestCanary(baseURL, issuer, serial, cCtx.Duration("timeout"))
+}
+
+// requestCanary asks the responder for the status of serial and verifies
+// the signed response against the issuer
+func requestCanary(baseURL string, issuer *x509.Certificate, serial *big.Int, timeout time.Duration) (string, error) {
+	// only the serial number is used to build the request
+	cert := &x509.Certificate{SerialNumber: serial}
+
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not create the OCSP request: %v", err)
+	}
+
+	der, err := sendOCSPRequest(baseURL+"/", http.MethodPost, request, timeout)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := ocsp.ParseResponseForCert(der, cert, issuer)
+	if err != nil {
+		return "", fmt.Errorf("invalid OCSP response: %v", err)
+	}
+	if err := verifyResponderCertificate(response, issuer); err != nil {
+		return "", err
+	}
+	if !response.NextUpdate.IsZero() && response.NextUpdate.Before(time.Now()) {
+		return "", fmt.Errorf("the response is stale, its next update is in the past")
+	}
+
+	// the responder only answers unknown when it couldn't look the serial up
+	switch response.Status {
+	case ocsp.Good:
+		return "good", nil
+	case ocsp.Revoked:
+		return "revoked", nil
+	default:
+		return "", errors.New("the status of the canary serial is unknown, the responder couldn't look it up")
+	}
+}
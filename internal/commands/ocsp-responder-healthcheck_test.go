@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// responder returns a delegated OCSP signing certificate of the CA and its
+// key, with id-pkix-ocsp-nocheck if noCheck is set
+func (ca testCA) responder(t *testing.T, noCheck bool) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "OCSP responder"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}
+	if noCheck {
+		template.ExtraExtensions = []pkix.Extension{{Id: oidOCSPNoCheck, Value: asn1.NullBytes}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestRequestCanary(t *testing.T) {
+	ca := newTestCA(t, "CA")
+	other := newTestCA(t, "other CA")
+	delegated, delegatedKey := ca.responder(t, true)
+	withoutNoCheck, withoutNoCheckKey := ca.responder(t, false)
+
+	tests := []struct {
+		name       string
+		status     int
+		nextUpdate time.Duration
+		signer     *x509.Certificate
+		key        crypto.Signer
+		want       string
+		wantErr    bool
+	}{
+		{name: "good", status: ocsp.Good, nextUpdate: time.Hour, want: "good"},
+		{name: "revoked", status: ocsp.Revoked, nextUpdate: time.Hour, want: "revoked"},
+		{name: "unknown", status: ocsp.Unknown, nextUpdate: time.Hour, wantErr: true},
+		{name: "stale", status: ocsp.Good, nextUpdate: -time.Minute, wantErr: true},
+		{name: "delegated responder", status: ocsp.Good, nextUpdate: time.Hour, signer: delegated, key: delegatedKey, want: "good"},
+		{name: "delegated responder without nocheck", status: ocsp.Good, nextUpdate: time.Hour, signer: withoutNoCheck, key: withoutNoCheckKey, wantErr: true},
+		{name: "signed by another CA", status: ocsp.Good, nextUpdate: time.Hour, signer: other.cert, key: other.key, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, key := ca.cert, ca.key
+			if tt.signer != nil {
+				signer, key = tt.signer, tt.key
+			}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				req, err := ocsp.ParseRequest(body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				now := time.Now()
+				template := ocsp.Response{
+					Status:       tt.status,
+					SerialNumber: req.SerialNumber,
+					ThisUpdate:   now.Add(-2 * time.Hour),
+					NextUpdate:   now.Add(tt.nextUpdate),
+				}
+				if tt.status == ocsp.Revoked {
+					template.RevokedAt = now.Add(-time.Hour)
+					template.RevocationReason = ocsp.KeyCompromise
+				}
+				if signer != ca.cert {
+					template.Certificate = signer
+				}
+				der, err := ocsp.CreateResponse(ca.cert, signer, template, key)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/ocsp-response")
+				w.Write(der)
+			}))
+			defer server.Close()
+
+			got, err := requestCanary(server.URL, ca.cert, big.NewInt(1234), 2*time.Second)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("requestCanary() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("requestCanary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
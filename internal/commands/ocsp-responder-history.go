@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/scncore/scncore-ocsp-responder/internal/models"
+	"github.com/scncore/scncore-ocsp-responder/internal/server/handler"
+	"github.com/urfave/cli/v2"
+)
+
+func HistoryOCSPResponder() *cli.Command {
+	return &cli.Command{
+		Name:   "history",
+		Usage:  "Show the revocation history of a certificate or its status at a given time",
+		Action: historyOCSPResponder,
+		Flags: []cli.Flag{
+			dburlFlag(),
+			&cli.StringFlag{
+				Name:     "serial",
+				Usage:    "the serial number of the certificate, decimal or hexadecimal prefixed with 0x",
+				Required: true,
+			},
+			&cli.TimestampFlag{
+				Name:   "at",
+				Usage:  "print the status the responder would have returned at this time, e.g (2025-01-31T10:00:00Z)",
+				Layout: time.RFC3339,
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the result as JSON",
+			},
+		},
+	}
+}
+
+func historyOCSPResponder(cCtx *cli.Context) error {
+	serial, err := handler.ParseSerial(cCtx.String("serial"))
+	if err != nil {
+		return err
+	}
+
+	model, err := models.New([]string{primaryDBUrl(cCtx)}, models.PoolConfig{})
+	if err != nil {
+		return fmt.Errorf("could not connect with database, reason: %v", err)
+	}
+	defer model.Close()
+
+	ctx := context.Background()
+	if at := cCtx.Timestamp("at"); at != nil {
+		status, err := model.GetStatusAt(ctx, serial.Int64(), *at)
+		if err != nil {
+			return fmt.Errorf("could not get the status of the certificate, reason: %v", err)
+		}
+		if cCtx.Bool("json") {
+			return json.NewEncoder(os.Stdout).Encode(status)
+		}
+
+		reason := ""
+		if status.Reason != nil {
+			reason = fmt.Sprintf(" (%s)", models.ReasonName(*status.Reason))
+		}
+		fmt.Printf("%s was %s%s at %s, according to the %s\n", serial, status.Status, reason, at.Format(time.RFC3339), status.Source)
+		return nil
+	}
+
+	events, err := model.GetHistory(ctx, serial.Int64())
+	if err != nil {
+		return fmt.Errorf("could not get the revocation history, reason: %v", err)
+	}
+	if cCtx.Bool("json") {
+		return json.NewEncoder(os.Stdout).Encode(events)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tOLD STATUS\tNEW STATUS\tACTOR\tISSUER")
+	for _, e := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.CreatedAt.Format(time.RFC3339), statusText(e.OldStatus, e.OldReason), statusText(e.NewStatus, e.Reason), e.Actor, e.Issuer)
+	}
+	return w.Flush()
+}
+
+func statusText(status string, reason *int) string {
+	if reason == nil {
+		return status
+	}
+	return fmt.Sprintf("%s (%s)", status, models.ReasonName(*reason))
+}
@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/scncore/ent"
+	"github.com/scncore/scncore-ocsp-responder/internal/models"
+	"github.com/scncore/utils"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ocsp"
+)
+
+func ImportCRLOCSPResponder() *cli.Command {
+	return &cli.Command{
+		Name:  "import-crl",
+		Usage: "Seed the revocation table from a CRL",
+		Description: "The CRL signature is verified against --cacert. Entries are created with their serial,\n" +
+			"revocation time and reason. Stored revocations with another reason or time are reported as\n" +
+			"conflicts and kept, unless --overwrite is set. Permanently revoked certificates are never put\n" +
+			"on hold",
+		Action: importCRL,
+		Flags: []cli.Flag{
+			dburlFlag(),
+			&cli.StringFlag{
+				Name:     "crl",
+				Usage:    "the path to the CRL, PEM or DER encoded",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "cacert",
+				Usage:    "the path to the PEM certificate of the CA that signed the CRL",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "overwrite",
+				Usage: "replace the reason and revocation time of stored revocations that conflict with the CRL",
+			},
+			&cli.BoolFlag{
+				Name:  "allow-expired",
+				Usage: "import a CRL whose next update is in the past",
+			},
+			&cli.StringFlag{
+				Name:  "actor",
+				Usage: "who is making the change, recorded in the revocation history, defaults to the current user",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "check the changes without making them",
+			},
+		},
+	}
+}
+
+func importCRL(cCtx *cli.Context) error {
+	caCert, err := utils.ReadPEMCertificate(cCtx.String("cacert"))
+	if err != nil {
+		return fmt.Errorf("could not read the CA certificate, reason: %v", err)
+	}
+
+	crl, err := readCRL(cCtx.String("crl"))
+	if err != nil {
+		return err
+	}
+	if err := verifyCRL(crl, caCert, cCtx.Bool("allow-expired")); err != nil {
+		return err
+	}
+	revocations, skipped := crlRevocations(crl)
+
+	model, err := models.New([]string{primaryDBUrl(cCtx)}, models.PoolConfig{})
+	if err != nil {
+		return fmt.Errorf("could not connect with database, reason: %v", err)
+	}
+	defer model.Close()
+
+	result, err := model.ImportRevocations(context.Background(), revocations, models.ImportOptions{
+		Issuer:       caCert.Subject.String(),
+		Actor:        cliActor(cCtx),
+		DryRun:       cCtx.Bool("dry-run"),
+		KeepExisting: !cCtx.Bool("overwrite"),
+		StatusOnly:   true,
+	})
+	if err != nil {
+		return fmt.Errorf("could not import the CRL, no change has been made, reason: %v", err)
+	}
+
+	for _, c := range result.Conflicts {
+		if c.Permanent {
+			fmt.Printf("%d: conflict, permanently revoked as %s, the CRL puts it on hold\n", c.Existing.ID, models.ReasonName(c.Existing.Reason))
+			continue
+		}
+		fmt.Printf("%d: conflict, stored as %s at %s, the CRL has %s at %s\n", c.Existing.ID,
+			models.ReasonName(c.Existing.Reason), c.Existing.Revoked.Format(time.RFC3339),
+			models.ReasonName(c.Imported.Reason), c.Imported.Revoked.Format(time.RFC3339))
+	}
+
+	summary := fmt.Sprintf("%d entries: %d created, %d updated, %d unchanged, %d conflicts, %d skipped",
+		len(crl.RevokedCertificateEntries), result.Created, result.Updated, result.Unchanged, len(result.Conflicts), skipped)
+	if cCtx.Bool("dry-run") {
+		fmt.Printf("dry run, no change has been made: %s\n", summary)
+	} else {
+		fmt.Println(summary)
+	}
+	return nil
+}
+
+// verifyCRL checks that the CRL has been issued and signed by the CA and,
+// unless allowExpired is set, that it hasn't expired
+func verifyCRL(crl *x509.RevocationList, caCert *x509.Certificate, allowExpired bool) error {
+	if !bytes.Equal(crl.RawIssuer, caCert.RawSubject) {
+		return fmt.Errorf("the CRL has been issued by %s, not by %s", crl.Issuer, caCert.Subject)
+	}
+	if err := crl.CheckSignatureFrom(caCert); err != nil {
+		return fmt.Errorf("the CRL signature is not valid, reason: %v", err)
+	}
+	if !crl.NextUpdate.IsZero() && crl.NextUpdate.Before(time.Now()) && !allowExpired {
+		return fmt.Errorf("the CRL expired at %s, use --allow-expired to import it anyway", crl.NextUpdate.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// crlRevocations returns the revocations of the CRL entries and the number
+// of entries skipped, as they can't be stored
+func crlRevocations(crl *x509.RevocationList) ([]*ent.Revocation, int) {
+	info := fmt.Sprintf("imported from CRL issued at %s", crl.ThisUpdate.Format(time.RFC3339))
+	if crl.Number != nil {
+		info = fmt.Sprintf("imported from CRL number %s", crl.Number)
+	}
+
+	revocations := []*ent.Revocation{}
+	skipped := 0
+	for _, entry := range crl.RevokedCertificateEntries {
+		switch {
+		case !entry.SerialNumber.IsInt64() || entry.SerialNumber.Sign() < 0:
+			fmt.Printf("%s: skipped, serials are stored as 64-bit integers\n", entry.SerialNumber)
+			skipped++
+		case entry.ReasonCode == ocsp.RemoveFromCRL:
+			fmt.Printf("%s: skipped, removeFromCRL entries only exist in delta CRLs\n", entry.SerialNumber)
+			skipped++
+		default:
+			revocations = append(revocations, &ent.Revocation{
+				ID:      entry.SerialNumber.Int64(),
+				Reason:  entry.ReasonCode,
+				Info:    info,
+				Revoked: entry.RevocationTime,
+			})
+		}
+	}
+	return revocations, skipped
+}
+
+// readCRL parses a PEM or DER encoded CRL
+func readCRL(path string) (*x509.RevocationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("%s holds a %s, not a CRL", path, block.Type)
+		}
+		data = block.Bytes
+	}
+
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the CRL, reason: %v", err)
+	}
+	return crl, nil
+}
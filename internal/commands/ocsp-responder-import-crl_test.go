@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// testCA signs the certificates, CRLs and OCSP responses of the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T, name string) testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCA{cert: cert, key: key}
+}
+
+// crl returns a CRL of the CA with the entries, valid until nextUpdate
+func (ca testCA) crl(t *testing.T, nextUpdate time.Time, entries []x509.RevocationListEntry) *x509.RevocationList {
+	t.Helper()
+
+	template := &x509.RevocationList{
+		Number:                    big.NewInt(42),
+		ThisUpdate:                nextUpdate.Add(-48 * time.Hour),
+		NextUpdate:                nextUpdate,
+		RevokedCertificateEntries: entries,
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crl
+}
+
+func TestVerifyCRL(t *testing.T) {
+	ca := newTestCA(t, "CA")
+	impostor := newTestCA(t, "CA")
+	other := newTestCA(t, "other CA")
+	valid := time.Now().Add(time.Hour)
+	expired := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name         string
+		crl          *x509.RevocationList
+		allowExpired bool
+		wantErr      bool
+	}{
+		{name: "valid", crl: ca.crl(t, valid, nil)},
+		{name: "other issuer", crl: other.crl(t, valid, nil), wantErr: true},
+		{name: "signed by another key", crl: impostor.crl(t, valid, nil), wantErr: true},
+		{name: "expired", crl: ca.crl(t, expired, nil), wantErr: true},
+		{name: "expired allowed", crl: ca.crl(t, expired, nil), allowExpired: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyCRL(tt.crl, ca.cert, tt.allowExpired); (err != nil) != tt.wantErr {
+				t.Errorf("verifyCRL() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCRLRevocations(t *testing.T) {
+	ca := newTestCA(t, "CA")
+	revoked := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	tooLarge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	crl := ca.crl(t, time.Now().Add(time.Hour), []x509.RevocationListEntry{
+		{SerialNumber: big.NewInt(10), RevocationTime: revoked, ReasonCode: ocsp.KeyCompromise},
+		{SerialNumber: tooLarge, RevocationTime: revoked},
+		{SerialNumber: big.NewInt(11), RevocationTime: revoked, ReasonCode: ocsp.RemoveFromCRL},
+		{SerialNumber: big.NewInt(12), RevocationTime: revoked, ReasonCode: ocsp.CertificateHold},
+	})
+
+	revocations, skipped := crlRevocations(crl)
+	if skipped != 2 {
+		t.Errorf("skipped = %d, want 2", skipped)
+	}
+	if len(revocations) != 2 {
+		t.Fatalf("%d revocations, want 2", len(revocations))
+	}
+	for i, want := range []struct {
+		id     int64
+		reason int
+	}{{10, ocsp.KeyCompromise}, {12, ocsp.CertificateHold}} {
+		r := revocations[i]
+		if r.ID != want.id || r.Reason != want.reason || !r.Revoked.Equal(revoked) || r.Info != "imported from CRL number 42" {
+			t.Errorf("revocation %d = %+v, want serial %d with reason %d revoked at %s", i, r, want.id, want.reason, revoked)
+		}
+		if !r.Expiry.IsZero() {
+			t.Errorf("revocation %d has the expiry %s, CRLs don't tell it", i, r.Expiry)
+		}
+	}
+}
+
+func TestReadCRL(t *testing.T) {
+	ca := newTestCA(t, "CA")
+	crl := ca.crl(t, time.Now().Add(time.Hour), nil)
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr bool
+	}{
+		{name: "DER", content: crl.Raw},
+		{name: "PEM", content: pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl.Raw})},
+		{name: "PEM certificate", content: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), wantErr: true},
+		{name: "garbage", content: []byte("not a CRL"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".crl")
+			if err := os.WriteFile(path, tt.content, 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readCRL(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readCRL() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err == nil && got.Number.Cmp(crl.Number) != 0 {
+				t.Errorf("readCRL() number = %s, want %s", got.Number, crl.Number)
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/scncore/scncore-ocsp-responder/internal/models"
+	"github.com/scncore/utils"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	hashNames = map[string]string{
+		"1.3.14.3.2.26":          "SHA-1",
+		"2.16.840.1.101.3.4.2.1": "SHA-256",
+		"2.16.840.1.101.3.4.2.2": "SHA-384",
+		"2.16.840.1.101.3.4.2.3": "SHA-512",
+	}
+	extensionNames = map[string]string{
+		"1.3.6.1.5.5.7.48.1.2": "nonce",
+		"1.3.6.1.5.5.7.48.1.3": "CRL references",
+		"1.3.6.1.5.5.7.48.1.4": "acceptable responses",
+		"1.3.6.1.5.5.7.48.1.6": "archive cutoff",
+		"1.3.6.1.5.5.7.48.1.7": "service locator",
+		"1.3.6.1.5.5.7.48.1.8": "preferred signature algorithms",
+		"1.3.6.1.5.5.7.48.1.9": "extended revoke",
+	}
+	responseStatusNames = map[int]string{
+		0: "successful",
+		1: "malformedRequest",
+		2: "internalError",
+		3: "tryLater",
+		5: "sigRequired",
+		6: "unauthorized",
+	}
+)
+
+// tagEnumerated is missing from the asn1 package constants
+const tagEnumerated = 10
+
+// ASN.1 structures of RFC 6960 that the ocsp package doesn't expose
+type singleRequestASN1 struct {
+	CertID     certIDASN1
+	Extensions []pkix.Extension `asn1:"explicit,tag:0,optional"`
+}
+
+type certIDASN1 struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type requestSignatureASN1 struct {
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type singleResponseASN1 struct {
+	CertID     certIDASN1
+	Good       asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked    revokedInfoASN1  `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type revokedInfoASN1 struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+func InspectOCSPResponder() *cli.Command {
+	return &cli.Command{
+		Name:  "inspect",
+		Usage: "Decode an OCSP request or response",
+		Description: "The input is read from --file, --path or stdin. It may be DER, PEM, base64 or a GET path\n" +
+			"as found in proxy logs, whether it holds a request or a response is detected",
+		Action: inspectOCSP,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "file",
+				Usage: "the path to the file holding the request or response, - reads stdin",
+			},
+			&cli.StringFlag{
+				Name:  "path",
+				Usage: "a GET request path or URL, e.g (/ocsp/MFQwUjBQ...)",
+			},
+			&cli.StringFlag{
+				Name:  "issuer",
+				Usage: "the path to the PEM certificate of the CA, used to verify response signatures",
+			},
+		},
+	}
+}
+
+func inspectOCSP(cCtx *cli.Context) error {
+	var der []byte
+	var err error
+	switch {
+	case cCtx.String("file") != "" && cCtx.String("path") != "":
+		return errors.New("use either --file or --path")
+	case cCtx.String("path") != "":
+		der, err = decodeRequestPath(cCtx.String("path"))
+	case cCtx.String("file") != "" && cCtx.String("file") != "-":
+		var data []byte
+		if data, err = os.ReadFile(cCtx.String("file")); err == nil {
+			der, err = decodeOCSPInput(data)
+		}
+	default:
+		var data []byte
+		if data, err = io.ReadAll(os.Stdin); err == nil {
+			der, err = decodeOCSPInput(data)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var issuer *x509.Certificate
+	if cCtx.String("issuer") != "" {
+		if issuer, err = utils.ReadPEMCertificate(cCtx.String("issuer")); err != nil {
+			return fmt.Errorf("could not read the issuer certificate, reason: %v", err)
+		}
+	}
+
+	// a response starts with its status, a request with its TBSRequest
+	var outer, first asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &outer); err != nil {
+		return fmt.Errorf("the input is not DER encoded, reason: %v", err)
+	}
+	if _, err := asn1.Unmarshal(outer.Bytes, &first); err != nil {
+		return fmt.Errorf("the input is not an OCSP request or response, reason: %v", err)
+	}
+	switch first.Tag {
+	case tagEnumerated:
+		return inspectResponse(der, issuer)
+	case asn1.TagSequence:
+		return inspectRequest(der)
+	default:
+		return errors.New("the input is not an OCSP request or response")
+	}
+}
+
+// decodeOCSPInput accepts DER, PEM, base64 or a GET path
+func decodeOCSPInput(data []byte) ([]byte, error) {
+	if len(data) > 0 && data[0] == 0x30 {
+		return data, nil
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		return block.Bytes, nil
+	}
+	return decodeRequestPath(strings.TrimSpace(string(data)))
+}
+
+// decodeRequestPath finds the base64 request in a GET path, which may be
+// prefixed by the responder's own path
+func decodeRequestPath(value string) ([]byte, error) {
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" {
+		value = u.EscapedPath()
+	}
+	path, err := url.PathUnescape(value)
+	if err != nil {
+		return nil, fmt.Errorf("could not unescape the path, reason: %v", err)
+	}
+	path = strings.TrimPrefix(path, "/")
+
+	for {
+		for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+			if der, err := encoding.DecodeString(path); err == nil && len(der) > 0 && der[0] == 0x30 {
+				return der, nil
+			}
+		}
+		i := strings.Index(path, "/")
+		if i == -1 {
+			return nil, errors.New("no base64 encoded OCSP request or response found in the input")
+		}
+		path = path[i+1:]
+	}
+}
+
+func inspectRequest(der []byte) error {
+	var req ocspRequestASN1
+	if rest, err := asn1.Unmarshal(der, &req); err != nil {
+		return fmt.Errorf("could not parse the OCSP request, reason: %v", err)
+	} else if len(rest) > 0 {
+		return errors.New("trailing data after the OCSP request")
+	}
+
+	fmt.Println("OCSP Request")
+	fmt.Printf("  Version: %d\n", req.TBSRequest.Version+1)
+	if len(req.TBSRequest.RequestorName.FullBytes) > 0 {
+		fmt.Printf("  Requestor name: %s\n", generalName(req.TBSRequest.RequestorName))
+	}
+
+	for i, raw := range req.TBSRequest.RequestList {
+		var single singleRequestASN1
+		if _, err := asn1.Unmarshal(raw.FullBytes, &single); err != nil {
+			return fmt.Errorf("could not parse request %d, reason: %v", i+1, err)
+		}
+		fmt.Printf("  Request %d\n", i+1)
+		printCertID("    ", single.CertID)
+		printExtensions("    ", "Single extensions", single.Extensions)
+	}
+	printExtensions("  ", "Request extensions", req.TBSRequest.Extensions)
+
+	if len(req.OptionalSignature.FullBytes) == 0 {
+		fmt.Println("  Signature: none")
+		return nil
+	}
+	var signature requestSignatureASN1
+	if _, err := asn1.Unmarshal(req.OptionalSignature.Bytes, &signature); err != nil {
+		return fmt.Errorf("could not parse the request signature, reason: %v", err)
+	}
+	fmt.Printf("  Signature algorithm: %s\n", signature.SignatureAlgorithm.Algorithm)
+	fmt.Printf("  Signature: %X\n", signature.Signature.RightAlign())
+	printCertificates("  ", signature.Certificates, nil)
+	return nil
+}
+
+func inspectResponse(der []byte, issuer *x509.Certificate) error {
+	var resp ocspResponseASN1
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return fmt.Errorf("could not parse the OCSP response, reason: %v", err)
+	} else if len(rest) > 0 {
+		return errors.New("trailing data after the OCSP response")
+	}
+
+	fmt.Println("OCSP Response")
+	fmt.Printf("  Response status: %s (%d)\n", responseStatusNames[int(resp.Status)], resp.Status)
+	if resp.Status != 0 {
+		return nil
+	}
+	fmt.Printf("  Response type: %s\n", resp.ResponseBytes.ResponseType)
+
+	var basic basicResponseASN1
+	if _, err := asn1.Unmarshal(resp.ResponseBytes.Response, &basic); err != nil {
+		return fmt.Errorf("could not parse the basic OCSP response, reason: %v", err)
+	}
+	tbs := basic.TBSResponseData
+
+	fmt.Printf("  Version: %d\n", tbs.Version+1)
+	switch tbs.RawResponderID.Tag {
+	case 1:
+		var name pkix.RDNSequence
+		if _, err := asn1.Unmarshal(tbs.RawResponderID.Bytes, &name); err != nil {
+			return fmt.Errorf("invalid responder name, reason: %v", err)
+		}
+		fmt.Printf("  Responder ID (name): %s\n", name)
+	case 2:
+		var keyHash []byte
+		if _, err := asn1.Unmarshal(tbs.RawResponderID.Bytes, &keyHash); err != nil {
+			return fmt.Errorf("invalid responder key hash, reason: %v", err)
+		}
+		fmt.Printf("  Responder ID (key hash): %X\n", keyHash)
+	default:
+		fmt.Printf("  Responder ID: invalid tag %d\n", tbs.RawResponderID.Tag)
+	}
+	fmt.Printf("  Produced at: %s\n", tbs.ProducedAt.Format(time.RFC3339))
+
+	var firstSerial *big.Int
+	for i, raw := range tbs.Responses {
+		var single singleResponseASN1
+		if _, err := asn1.Unmarshal(raw.FullBytes, &single); err != nil {
+			return fmt.Errorf("could not parse response %d, reason: %v", i+1, err)
+		}
+		if firstSerial == nil {
+			firstSerial = single.CertID.SerialNumber
+		}
+
+		fmt.Printf("  Response %d\n", i+1)
+		printCertID("    ", single.CertID)
+		switch {
+		case bool(single.Good):
+			fmt.Println("    Certificate status: good")
+		case bool(single.Unknown):
+			fmt.Println("    Certificate status: unknown")
+		default:
+			fmt.Println("    Certificate status: revoked")
+			fmt.Printf("    Revocation time: %s\n", single.Revoked.RevocationTime.Format(time.RFC3339))
+			fmt.Printf("    Revocation reason: %s (%d)\n", models.ReasonName(int(single.Revoked.Reason)), single.Revoked.Reason)
+		}
+		fmt.Printf("    This update: %s\n", single.ThisUpdate.Format(time.RFC3339))
+		if !single.NextUpdate.IsZero() {
+			fmt.Printf("    Next update: %s\n", single.NextUpdate.Format(time.RFC3339))
+		}
+		printExtensions("    ", "Single extensions", single.Extensions)
+	}
+	printExtensions("  ", "Response extensions", tbs.ResponseExtensions)
+
+	fmt.Printf("  Signature algorithm: %s\n", signatureAlgorithmName(der, basic.SignatureAlgorithm))
+	fmt.Printf("  Signature: %X\n", basic.Signature.RightAlign())
+	printCertificates("  ", basic.Certificates, issuer)
+
+	switch {
+	case issuer == nil:
+		fmt.Println("  Signature validity: not checked, set --issuer")
+	case firstSerial == nil:
+		fmt.Println("  Signature validity: not checked, the response holds no certificate status")
+	default:
+		// the signature covers every single response, checking it once for
+		// the first one is enough
+		if _, err := ocsp.ParseResponseForCert(der, &x509.Certificate{SerialNumber: firstSerial}, issuer); err != nil {
+			fmt.Printf("  Signature validity: invalid, %v\n", err)
+		} else {
+			fmt.Printf("  Signature validity: valid, verified against %s\n", issuer.Subject)
+		}
+	}
+	return nil
+}
+
+func printCertID(indent string, id certIDASN1) {
+	hash := hashNames[id.HashAlgorithm.Algorithm.String()]
+	if hash == "" {
+		hash = id.HashAlgorithm.Algorithm.String()
+	}
+	fmt.Printf("%sHash algorithm: %s\n", indent, hash)
+	fmt.Printf("%sIssuer name hash: %X\n", indent, id.IssuerNameHash)
+	fmt.Printf("%sIssuer key hash: %X\n", indent, id.IssuerKeyHash)
+	fmt.Printf("%sSerial number: %s (0x%X)\n", indent, id.SerialNumber, id.SerialNumber)
+}
+
+func printExtensions(indent string, title string, extensions []pkix.Extension) {
+	if len(extensions) == 0 {
+		return
+	}
+	fmt.Printf("%s%s\n", indent, title)
+	for _, ext := range extensions {
+		name := extensionNames[ext.Id.String()]
+		if name == "" {
+			name = ext.Id.String()
+		}
+		critical := ""
+		if ext.Critical {
+			critical = " (critical)"
+		}
+		fmt.Printf("%s  %s%s: %X\n", indent, name, critical, ext.Value)
+	}
+}
+
+func printCertificates(indent string, certificates []asn1.RawValue, issuer *x509.Certificate) {
+	for i, raw := range certificates {
+		fmt.Printf("%sCertificate %d\n", indent, i+1)
+		cert, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			fmt.Printf("%s  invalid certificate: %v\n", indent, err)
+			continue
+		}
+		fmt.Printf("%s  Subject: %s\n", indent, cert.Subject)
+		fmt.Printf("%s  Issuer: %s\n", indent, cert.Issuer)
+		fmt.Printf("%s  Serial number: %s\n", indent, cert.SerialNumber)
+		fmt.Printf("%s  Validity: %s to %s\n", indent, cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+		fmt.Printf("%s  OCSP signing: %t\n", indent, slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageOCSPSigning))
+		if issuer != nil && !bytes.Equal(cert.Raw, issuer.Raw) {
+			if err := cert.CheckSignatureFrom(issuer); err != nil {
+				fmt.Printf("%s  Signed by the issuer: no, %v\n", indent, err)
+			} else {
+				fmt.Printf("%s  Signed by the issuer: yes\n", indent)
+			}
+		}
+	}
+}
+
+// signatureAlgorithmName names the signature algorithm of a response, or
+// prints its OID if the ocsp package doesn't know it
+func signatureAlgorithmName(der []byte, algorithm pkix.AlgorithmIdentifier) string {
+	if r, err := ocsp.ParseResponse(der, nil); err == nil && r.SignatureAlgorithm != x509.UnknownSignatureAlgorithm {
+		return r.SignatureAlgorithm.String()
+	}
+	return algorithm.Algorithm.String()
+}
+
+// generalName prints the directory name of a GeneralName, other forms in
+// hexadecimal
+func generalName(raw asn1.RawValue) string {
+	var name asn1.RawValue
+	if _, err := asn1.Unmarshal(raw.Bytes, &name); err == nil && name.Tag == 4 {
+		var rdn pkix.RDNSequence
+		if _, err := asn1.Unmarshal(name.Bytes, &rdn); err == nil {
+			return rdn.String()
+		}
+	}
+	return fmt.Sprintf("%X", raw.Bytes)
+}
@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/scncore/scncore-ocsp-responder/internal/models"
+	"github.com/urfave/cli/v2"
+)
+
+func MigrateOCSPResponder() *cli.Command {
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: "Apply the database schema required by the OCSP Responder",
+		Description: "Creates or updates the revocation history and audit tables owned by the responder and\n" +
+			"records their schema version. The revocations table is shared with the rest of scncore and\n" +
+			"is left to the scncore server, the migration only checks it",
+		Action: migrateOCSPResponder,
+		Flags: []cli.Flag{
+			dburlFlag(),
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "print the planned DDL statements without applying them",
+			},
+		},
+	}
+}
+
+func migrateOCSPResponder(cCtx *cli.Context) error {
+	model, err := models.New([]string{primaryDBUrl(cCtx)}, models.PoolConfig{})
+	if err != nil {
+		return fmt.Errorf("could not connect with database, reason: %v", err)
+	}
+	defer model.Close()
+
+	dryRun := cCtx.Bool("dry-run")
+	if err := model.Migrate(context.Background(), dryRun, os.Stdout); err != nil {
+		return fmt.Errorf("could not migrate the database schema, reason: %v", err)
+	}
+
+	if !dryRun {
+		slog.Info("the database schema has been migrated")
+	}
+	return nil
+}
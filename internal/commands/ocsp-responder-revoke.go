@@ -0,0 +1,297 @@
+package commands
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/scncore/scncore-ocsp-responder/internal/models"
+	"github.com/scncore/scncore-ocsp-responder/internal/server/handler"
+	"github.com/scncore/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// revocationItem is a certificate to revoke or unrevoke, as read from the
+// flags or a bulk file
+type revocationItem struct {
+	Serial string    `json:"serial"`
+	Reason string    `json:"reason"`
+	Info   string    `json:"info"`
+	Expiry time.Time `json:"expiry"`
+	Issuer string    `json:"-"`
+}
+
+func RevokeOCSPResponder() *cli.Command {
+	return &cli.Command{
+		Name:  "revoke",
+		Usage: "Revoke certificates, or change the reason of their revocation",
+		Description: "Certificates are given by --serial, --cert or, for bulk revocations, a CSV or JSON --file.\n" +
+			"CSV files need a header with a serial column and optional reason, info and expiry columns,\n" +
+			"JSON files hold an array of objects with the same fields. Running responders serve the change\n" +
+			"right away",
+		Action: revokeCertificates,
+		Flags: append(revocationFlags(),
+			&cli.StringFlag{
+				Name:  "reason",
+				Usage: "the RFC 5280 reason code or name, used for entries of the file without a reason",
+				Value: "unspecified",
+			},
+			&cli.StringFlag{
+				Name:  "info",
+				Usage: "a note stored with the revocation",
+			},
+			&cli.TimestampFlag{
+				Name:   "expiry",
+				Usage:  "when the certificate expires, e.g (2026-01-31T10:00:00Z), defaults to the certificate's expiry with --cert",
+				Layout: time.RFC3339,
+			},
+		),
+	}
+}
+
+func UnrevokeOCSPResponder() *cli.Command {
+	return &cli.Command{
+		Name:  "unrevoke",
+		Usage: "Release certificates from hold so they're good again",
+		Description: "Certificates are given by --serial, --cert or, for bulk operations, a CSV or JSON --file\n" +
+			"with a serial column or field. Only certificates on hold are released unless --force is set",
+		Action: unrevokeCertificates,
+		Flags: append(revocationFlags(),
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "delete revocations whatever their reason, to undo revocations made by mistake",
+			},
+		),
+	}
+}
+
+func revocationFlags() []cli.Flag {
+	return []cli.Flag{
+		dburlFlag(),
+		&cli.StringFlag{
+			Name:  "serial",
+			Usage: "the serial number of the certificate, decimal or hexadecimal prefixed with 0x",
+		},
+		&cli.StringFlag{
+			Name:  "cert",
+			Usage: "the path to the PEM certificate",
+		},
+		&cli.StringFlag{
+			Name:  "file",
+			Usage: "the path to a CSV or JSON file listing certificates",
+		},
+		&cli.StringFlag{
+			Name:  "actor",
+			Usage: "who is making the change, recorded in the revocation history, defaults to the current user",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "check the changes without making them",
+		},
+	}
+}
+
+func revokeCertificates(cCtx *cli.Context) error {
+	items, err := readRevocationItems(cCtx)
+	if err != nil {
+		return err
+	}
+
+	return applyRevocations(cCtx, items, func(ctx context.Context, model *models.Model, request models.RevocationRequest, item revocationItem) (string, error) {
+		reason := item.Reason
+		if reason == "" {
+			reason = cCtx.String("reason")
+		}
+		code, err := models.ParseReason(reason)
+		if err != nil {
+			return "", err
+		}
+		request.Reason = code
+		request.Info = item.Info
+		if request.Info == "" {
+			request.Info = cCtx.String("info")
+		}
+		request.Expiry = item.Expiry
+		if request.Expiry.IsZero() && cCtx.Timestamp("expiry") != nil {
+			request.Expiry = *cCtx.Timestamp("expiry")
+		}
+
+		_, change, err := model.Revoke(ctx, request)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s (%s)", change, models.ReasonName(code)), nil
+	})
+}
+
+func unrevokeCertificates(cCtx *cli.Context) error {
+	items, err := readRevocationItems(cCtx)
+	if err != nil {
+		return err
+	}
+
+	return applyRevocations(cCtx, items, func(ctx context.Context, model *models.Model, request models.RevocationRequest, item revocationItem) (string, error) {
+		if cCtx.Bool("force") {
+			return "unrevoked", model.Unrevoke(ctx, request)
+		}
+		return "released", model.Release(ctx, request)
+	})
+}
+
+type revocationChange func(ctx context.Context, model *models.Model, request models.RevocationRequest, item revocationItem) (string, error)
+
+// applyRevocations makes a change per item, one transaction each so a
+// failing entry doesn't stop the others, and prints a summary
+func applyRevocations(cCtx *cli.Context, items []revocationItem, change revocationChange) error {
+	actor := cliActor(cCtx)
+
+	model, err := models.New([]string{primaryDBUrl(cCtx)}, models.PoolConfig{})
+	if err != nil {
+		return fmt.Errorf("could not connect with database, reason: %v", err)
+	}
+	defer model.Close()
+
+	dryRun := cCtx.Bool("dry-run")
+	ctx := context.Background()
+	counts := map[string]int{}
+	failed := 0
+	for _, item := range items {
+		serial, err := handler.ParseSerial(item.Serial)
+		if err == nil {
+			request := models.RevocationRequest{Serial: serial.Int64(), Issuer: item.Issuer, Actor: actor, DryRun: dryRun}
+			var result string
+			if result, err = change(ctx, model, request, item); err == nil {
+				fmt.Printf("%s: %s\n", item.Serial, result)
+				counts[strings.Fields(result)[0]]++
+				continue
+			}
+		}
+		fmt.Printf("%s: failed, %v\n", item.Serial, err)
+		failed++
+	}
+
+	summary := []string{}
+	for _, kind := range []string{"revoked", "updated", "unchanged", "released", "unrevoked"} {
+		if counts[kind] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+	summary = append(summary, fmt.Sprintf("%d failed", failed))
+	if dryRun {
+		fmt.Printf("dry run, no change has been made: %s\n", strings.Join(summary, ", "))
+	} else {
+		fmt.Println(strings.Join(summary, ", "))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d certificates could not be changed", failed, len(items))
+	}
+	return nil
+}
+
+// cliActor identifies who runs a command in the revocation history
+func cliActor(cCtx *cli.Context) string {
+	if actor := cCtx.String("actor"); actor != "" {
+		return actor
+	}
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli:unknown"
+}
+
+func readRevocationItems(cCtx *cli.Context) ([]revocationItem, error) {
+	sources := 0
+	for _, flag := range []string{"serial", "cert", "file"} {
+		if cCtx.String(flag) != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, errors.New("use one of --serial, --cert or --file")
+	}
+
+	switch {
+	case cCtx.String("serial") != "":
+		return []revocationItem{{Serial: cCtx.String("serial")}}, nil
+	case cCtx.String("cert") != "":
+		cert, err := utils.ReadPEMCertificate(cCtx.String("cert"))
+		if err != nil {
+			return nil, fmt.Errorf("could not read the certificate: %v", err)
+		}
+		return []revocationItem{{Serial: cert.SerialNumber.String(), Expiry: cert.NotAfter, Issuer: cert.Issuer.String()}}, nil
+	default:
+		return readRevocationFile(cCtx.String("file"))
+	}
+}
+
+// readRevocationFile reads a JSON file if its extension is .json, a CSV
+// file otherwise
+func readRevocationFile(path string) ([]revocationItem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	items := []revocationItem{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.NewDecoder(f).Decode(&items); err != nil {
+			return nil, fmt.Errorf("could not read %s: %v", path, err)
+		}
+		return items, nil
+	}
+
+	reader := csv.NewReader(f)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the header of %s: %v", path, err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	if !slices.Contains(header, "serial") {
+		return nil, fmt.Errorf("%s has no serial column", path)
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %v", path, err)
+		}
+
+		item := revocationItem{}
+		for i, column := range header {
+			switch column {
+			case "serial":
+				item.Serial = record[i]
+			case "reason":
+				item.Reason = record[i]
+			case "info":
+				item.Info = record[i]
+			case "expiry":
+				if record[i] == "" {
+					continue
+				}
+				if item.Expiry, err = time.Parse(time.RFC3339, record[i]); err != nil {
+					return nil, fmt.Errorf("%s line %d: expiry must be a RFC 3339 time", path, line)
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadRevocationFile(t *testing.T) {
+	expiry := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []revocationItem
+		wantErr bool
+	}{
+		{
+			name:    "CSV",
+			file:    "revocations.csv",
+			content: "serial,reason,info,expiry\n10,keyCompromise,stolen laptop,2026-03-01T12:00:00Z\n0x0b,,,\n",
+			want: []revocationItem{
+				{Serial: "10", Reason: "keyCompromise", Info: "stolen laptop", Expiry: expiry},
+				{Serial: "0x0b"},
+			},
+		},
+		{
+			name:    "CSV with reordered columns and spaces",
+			file:    "revocations.txt",
+			content: "Reason, Serial\nsuperseded, 12\n",
+			want:    []revocationItem{{Serial: "12", Reason: "superseded"}},
+		},
+		{
+			name:    "CSV without serial column",
+			file:    "revocations.csv",
+			content: "id,reason\n10,keyCompromise\n",
+			wantErr: true,
+		},
+		{
+			name:    "CSV with invalid expiry",
+			file:    "revocations.csv",
+			content: "serial,expiry\n10,01/03/2026\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty CSV",
+			file:    "revocations.csv",
+			content: "",
+			wantErr: true,
+		},
+		{
+			name:    "JSON",
+			file:    "revocations.JSON",
+			content: `[{"serial":"10","reason":"1","expiry":"2026-03-01T12:00:00Z"},{"serial":"11","info":"test"}]`,
+			want: []revocationItem{
+				{Serial: "10", Reason: "1", Expiry: expiry},
+				{Serial: "11", Info: "test"},
+			},
+		},
+		{
+			name:    "invalid JSON",
+			file:    "revocations.json",
+			content: `{"serial":"10"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			items, err := readRevocationFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readRevocationFile() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(items, tt.want) {
+				t.Errorf("readRevocationFile() = %+v, want %+v", items, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/scncore/scncore-ocsp-responder/internal/pidfile"
+	"github.com/scncore/scncore-ocsp-responder/internal/server/handler"
+	"github.com/urfave/cli/v2"
+)
+
+// Exit codes of the status command, they follow the LSB init script
+// convention
+const (
+	statusRunning  = 0
+	statusDead     = 1
+	statusStopped  = 3
+	statusNotReady = 4
+)
+
+func StatusOCSPResponder() *cli.Command {
+	return &cli.Command{
+		Name:  "status",
+		Usage: "Show whether the OCSP Responder is running and ready",
+		Description: "Exits with 0 if the responder is running and ready, 1 if the PID file is stale, 3 if it's not\n" +
+			"running and 4 if it's running but not ready to sign responses",
+		Action: statusOCSPResponder,
+		Flags: []cli.Flag{
+			pidFileFlag(),
+			portFlag(),
+			urlFlag(),
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "the deadline for the readiness probe",
+				Value: 5 * time.Second,
+			},
+		},
+	}
+}
+
+func statusOCSPResponder(cCtx *cli.Context) error {
+	pidFile := cCtx.String("pid-file")
+
+	pid, err := pidfile.Read(pidFile)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("the OCSP responder is not running")
+		return cli.Exit("", statusStopped)
+	}
+	if err != nil {
+		return cli.Exit(err.Error(), statusNotReady)
+	}
+	if !pidfile.Running(pid) {
+		fmt.Printf("the OCSP responder is not running, but the PID file %s holds pid %d\n", pidFile, pid)
+		return cli.Exit("", statusDead)
+	}
+	fmt.Printf("the OCSP responder is running with pid %d\n", pid)
+
+	report, _, err := probeHealth(responderURL(cCtx), "/readyz", cCtx.Duration("timeout"))
+	if err != nil {
+		fmt.Printf("it could not be probed: %v\n", err)
+		return cli.Exit("", statusNotReady)
+	}
+
+	fmt.Printf("database: %s\n", healthLine(report.Database.Status, report.Database.Detail))
+	fmt.Printf("signer: %s\n", healthLine(report.Signer.Status, report.Signer.Detail))
+	fmt.Printf("CA: %s\n", healthLine(report.CA.Status, report.CA.Detail))
+	fmt.Printf("audit: %s\n", healthLine(report.Audit.Status, report.Audit.Detail))
+
+	if report.Status != "ok" {
+		fmt.Println("it is not ready to sign responses")
+		return cli.Exit("", statusNotReady)
+	}
+	fmt.Println("it is ready to sign responses")
+	return nil
+}
+
+// probeHealth queries a health probe of the responder, which answers with
+// a health report whether it's healthy or not
+func probeHealth(baseURL, path string, timeout time.Duration) (*handler.HealthReport, int, error) {
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Get(strings.TrimSuffix(baseURL, "/") + path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, resp.StatusCode, fmt.Errorf("%s answered %s", path, resp.Status)
+	}
+
+	report := handler.HealthReport{}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("could not decode the health report, reason: %v", err)
+	}
+	return &report, resp.StatusCode, nil
+}
+
+func healthLine(status, detail string) string {
+	if detail == "" {
+		return status
+	}
+	return status + ", " + detail
+}
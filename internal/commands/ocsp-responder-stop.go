@@ -1,46 +1,93 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
-	"strconv"
+	"time"
 
+	"github.com/scncore/scncore-ocsp-responder/internal/pidfile"
 	"github.com/urfave/cli/v2"
 )
 
 func StopOCSPResponder() *cli.Command {
 	return &cli.Command{
-		Name:   "stop",
-		Usage:  "Stop OCSP Responder server",
+		Name:  "stop",
+		Usage: "Stop OCSP Responder server",
+		Description: "Asks the responder to shut down and waits for it to drain its requests. If it's still running\n" +
+			"after --timeout it's killed",
 		Action: stopOCSPResponder,
+		Flags: []cli.Flag{
+			pidFileFlag(),
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "how long the responder is waited for before being killed, keep it above its shutdown timeout",
+				Value: 40 * time.Second,
+			},
+		},
 	}
 }
 
-func stopOCSPResponder(cCtx *cli.Context) error {
-	pidByte, err := os.ReadFile("PIDFILE")
-	if err != nil {
-		return fmt.Errorf("could not find the PIDFILE")
+func pidFileFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "pid-file",
+		Usage:   "the path to the file holding the pid of the running responder",
+		EnvVars: []string{"PID_FILE"},
+		Value:   pidfile.DefaultPath,
 	}
+}
 
-	pid, err := strconv.Atoi(string(pidByte))
+func stopOCSPResponder(cCtx *cli.Context) error {
+	pidFile := cCtx.String("pid-file")
+
+	pid, err := pidfile.Read(pidFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not find the PID file %s, is the OCSP responder running?", pidFile)
+	}
 	if err != nil {
-		return fmt.Errorf("could not parse the pid from PIDFILE")
+		return err
 	}
 
-	p, err := os.FindProcess(pid)
-	if err != nil {
-		return fmt.Errorf("could not find process associated with OCSP Responder")
+	if !pidfile.Running(pid) {
+		if err := pidfile.Remove(pidFile, pid); err != nil {
+			return err
+		}
+		return fmt.Errorf("the OCSP responder with pid %d is not running, the stale PID file has been removed", pid)
 	}
 
-	if err := p.Signal(os.Interrupt); err != nil {
+	if err := pidfile.Terminate(pid); err != nil {
 		return fmt.Errorf("could not terminate the process associated with OCSP Responder, reason: %s", err.Error())
 	}
 
-	log.Printf("👋 Done! Your OCSP responder has stopped listening\n\n")
+	timeout := cCtx.Duration("timeout")
+	if !waitForExit(pid, timeout) {
+		slog.Warn("the OCSP responder has not stopped in time, killing it", "pid", pid, "timeout", timeout)
+		if err := pidfile.Kill(pid); err != nil {
+			return fmt.Errorf("could not kill the process associated with OCSP Responder, reason: %s", err.Error())
+		}
+		if !waitForExit(pid, 5*time.Second) {
+			return fmt.Errorf("the OCSP responder with pid %d is still running after being killed", pid)
+		}
+	}
 
-	if err := os.Remove("PIDFILE"); err != nil {
+	// the responder removes its PID file unless it has been killed
+	if err := pidfile.Remove(pidFile, pid); err != nil {
 		return err
 	}
+
+	slog.Info("👋 Done! Your OCSP responder has stopped listening")
 	return nil
 }
+
+// waitForExit reports whether the process exited before the timeout
+func waitForExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for pidfile.Running(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
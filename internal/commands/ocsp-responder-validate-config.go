@@ -0,0 +1,234 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/scncore/scncore-ocsp-responder/internal/common"
+	"github.com/scncore/scncore-ocsp-responder/internal/models"
+	"github.com/scncore/scncore-ocsp-responder/internal/server"
+	"github.com/scncore/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// Results of a validation check, warnings don't make the validation fail
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// ValidationCheck is one line of the validate-config report
+type ValidationCheck struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type validationReport struct {
+	Checks []ValidationCheck `json:"checks"`
+	Valid  bool              `json:"valid"`
+}
+
+func (r *validationReport) add(name, result, detail string) {
+	r.Checks = append(r.Checks, ValidationCheck{Name: name, Result: result, Detail: detail})
+}
+
+// check adds a failed check if err isn't nil and a passed one otherwise
+func (r *validationReport) check(name string, err error, detail string) bool {
+	if err != nil {
+		r.add(name, checkFail, err.Error())
+		return false
+	}
+	r.add(name, checkPass, detail)
+	return true
+}
+
+func ValidateConfigOCSPResponder() *cli.Command {
+	return &cli.Command{
+		Name:  "validate-config",
+		Usage: "Check the configuration of the OCSP Responder without starting it",
+		Description: "Reads the config the same way as start, then resolves the certificate paths, connects with\n" +
+			"every database, verifies the certificate chain and the key pair and prints a report.\n" +
+			"Exits with 1 if a check fails",
+		Action: validateConfig,
+		Flags: append(common.OCSPResponderFlags(),
+			&cli.DurationFlag{
+				Name:  "expiry-warning",
+				Usage: "warn about certificates that expire within this duration",
+				Value: 30 * 24 * time.Hour,
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the report as JSON",
+			},
+		),
+	}
+}
+
+func validateConfig(cCtx *cli.Context) error {
+	report := validationReport{}
+	worker := common.NewWorker("")
+
+	err := worker.ReadOCSPResponderConfigFromCLI(cCtx)
+	source := "read from flags and environment variables"
+	if worker.ConfigFile != "" {
+		source += " and " + worker.ConfigFile
+	}
+	report.check("configuration", err, source)
+
+	if report.Checks[0].Result == checkPass {
+		validateCertificates(&report, worker, cCtx.Duration("expiry-warning"))
+		validateDatabases(&report, worker)
+	}
+
+	report.Valid = !slices.ContainsFunc(report.Checks, func(c ValidationCheck) bool { return c.Result == checkFail })
+
+	if cCtx.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, c := range report.Checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Result, c.Name, c.Detail)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if !report.Valid {
+		return cli.Exit("the configuration is not valid", 1)
+	}
+	if !cCtx.Bool("json") {
+		fmt.Println("the configuration is valid")
+	}
+	return nil
+}
+
+func validateCertificates(report *validationReport, w *common.Worker, expiryWarning time.Duration) {
+	caCert := readCertificate(report, "CA certificate", w.CACertFile, expiryWarning)
+	if caCert != nil && !caCert.IsCA {
+		report.add("CA certificate", checkWarn, "the basic constraints don't mark it as a CA")
+	}
+
+	ocspCert := readCertificate(report, "OCSP certificate", w.OCSPCertFile, expiryWarning)
+	if caCert != nil && ocspCert != nil {
+		validateChain(report, caCert, ocspCert)
+	}
+
+	key, err := common.ReadPrivateKey(w.OCSPKeyFile)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", w.OCSPKeyFile, err)
+	}
+	if report.check("OCSP key", err, w.OCSPKeyFile) && ocspCert != nil {
+		pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !pub.Equal(ocspCert.PublicKey) {
+			report.add("key pair", checkFail, "the OCSP key doesn't match the OCSP certificate")
+		} else {
+			report.add("key pair", checkPass, "the OCSP key matches the OCSP certificate")
+		}
+	}
+
+	if w.TLSOptions.CertFile != "" {
+		_, err := server.NewTLSConfig(w.TLSOptions)
+		report.check("TLS", err, w.TLSOptions.CertFile)
+	}
+
+	if w.Audit.Sink == "file" {
+		dir := filepath.Dir(w.Audit.File)
+		info, err := os.Stat(dir)
+		if err == nil && !info.IsDir() {
+			err = fmt.Errorf("%s is not a directory", dir)
+		}
+		report.check("audit file", err, w.Audit.File)
+	}
+}
+
+// readCertificate reports whether the certificate can be read and is valid
+// now, it returns nil if it can't be read
+func readCertificate(report *validationReport, name, path string, expiryWarning time.Duration) *x509.Certificate {
+	cert, err := utils.ReadPEMCertificate(path)
+	if err != nil {
+		report.add(name, checkFail, fmt.Sprintf("%s: %v", path, err))
+		return nil
+	}
+	report.add(name, checkPass, fmt.Sprintf("%s (%s)", cert.Subject, path))
+	validateValidity(report, name, cert, expiryWarning)
+	return cert
+}
+
+func validateValidity(report *validationReport, name string, cert *x509.Certificate, expiryWarning time.Duration) {
+	now := time.Now()
+	switch {
+	case now.Before(cert.NotBefore):
+		report.add(name, checkFail, "not valid before "+cert.NotBefore.Format(time.RFC3339))
+	case now.After(cert.NotAfter):
+		report.add(name, checkFail, "expired at "+cert.NotAfter.Format(time.RFC3339))
+	case now.Add(expiryWarning).After(cert.NotAfter):
+		report.add(name, checkWarn, "expires at "+cert.NotAfter.Format(time.RFC3339))
+	}
+}
+
+// validateChain checks that the OCSP certificate may sign responses for the
+// CA, either because it's the CA itself or a delegated responder
+func validateChain(report *validationReport, caCert, ocspCert *x509.Certificate) {
+	if bytes.Equal(caCert.Raw, ocspCert.Raw) {
+		report.add("chain", checkPass, "the CA signs the responses itself")
+		return
+	}
+
+	if err := ocspCert.CheckSignatureFrom(caCert); err != nil {
+		report.add("chain", checkFail, fmt.Sprintf("the OCSP certificate hasn't been issued by %s: %v", caCert.Subject, err))
+		return
+	}
+	if !slices.Contains(ocspCert.ExtKeyUsage, x509.ExtKeyUsageOCSPSigning) {
+		report.add("chain", checkFail, "the OCSP certificate lacks the OCSPSigning extended key usage")
+		return
+	}
+	report.add("chain", checkPass, "delegated responder issued by "+caCert.Subject.String())
+
+	if !slices.ContainsFunc(ocspCert.Extensions, func(e pkix.Extension) bool { return e.Id.Equal(oidOCSPNoCheck) }) {
+		report.add("chain", checkWarn, "the OCSP certificate lacks id-pkix-ocsp-nocheck, clients may check its revocation")
+	}
+}
+
+func validateDatabases(report *validationReport, w *common.Worker) {
+	if len(w.DBUrls) == 0 {
+		report.add("database", checkFail, "no database url is set")
+		return
+	}
+
+	for i, dbUrl := range w.DBUrls {
+		name := "database primary"
+		if i > 0 {
+			name = fmt.Sprintf("database replica %d", i)
+		}
+
+		model, err := models.New([]string{dbUrl}, w.DBPool)
+		if !report.check(name, err, "reachable") {
+			continue
+		}
+
+		err = model.CheckSchema(context.Background(), models.SchemaOptions{Audit: w.Audit.InDatabase()})
+		if report.check(name+" schema", err, "compatible") {
+			if err := model.CheckSchema(context.Background(), models.SchemaOptions{History: true}); err != nil {
+				report.add(name+" schema", checkWarn, "revocation changes won't be recorded, "+err.Error())
+			}
+		}
+		model.Close()
+	}
+}
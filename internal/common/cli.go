@@ -1,41 +1,165 @@
 package common
 
 import (
+	"errors"
+	"net"
 	"path/filepath"
 
-	"github.com/scncore/utils"
+	"github.com/scncore/scncore-ocsp-responder/internal/audit"
+	"github.com/scncore/scncore-ocsp-responder/internal/models"
+	"github.com/scncore/scncore-ocsp-responder/internal/server"
+	"github.com/scncore/scncore-ocsp-responder/internal/server/handler"
+	"github.com/scncore/scncore-ocsp-responder/internal/tracing"
 	"github.com/urfave/cli/v2"
 )
 
 func (w *Worker) GenerateOCSPResponderConfigFromCLI(cCtx *cli.Context) error {
-	var err error
+	if err := w.ReadOCSPResponderConfigFromCLI(cCtx); err != nil {
+		return err
+	}
+	return w.LoadCertificates()
+}
 
-	w.DBUrl = cCtx.String("dburl")
+// ReadOCSPResponderConfigFromCLI reads the settings of the flags, falling
+// back to the config file for those not set by a flag or an environment
+// variable. Relative paths that don't come from the config file are
+// resolved against the directory of the executable
+func (w *Worker) ReadOCSPResponderConfigFromCLI(cCtx *cli.Context) error {
+	var err error
 
-	cwd, err := GetWd()
+	w.ConfigFile, err = applyConfigFile(cCtx)
 	if err != nil {
 		return err
 	}
 
-	caCertPath := filepath.Join(cwd, cCtx.String("cacert"))
-	w.CACert, err = utils.ReadPEMCertificate(caCertPath)
-	if err != nil {
+	w.DBUrls = cCtx.StringSlice("dburl")
+	if len(w.DBUrls) == 0 {
+		return errors.New("a database url is required, set --dburl, DATABASE_URL or DBUrl in the config file")
+	}
+	w.LogLevel = cCtx.String("log-level")
+	w.LogFormat = cCtx.String("log-format")
+	if cCtx.Bool("debug") {
+		w.LogLevel = "debug"
+	}
+	if err := w.SetupLogging(); err != nil {
 		return err
 	}
+	w.LookupTimeout = cCtx.Duration("lookup-timeout")
+	w.Validity = handler.Validity{
+		NextUpdate:          cCtx.Duration("next-update"),
+		ThisUpdatePrecision: cCtx.Duration("this-update-precision"),
+	}
+	w.ShutdownTimeout = cCtx.Duration("shutdown-timeout")
+	w.Timeouts = server.Timeouts{
+		Read:  cCtx.Duration("read-timeout"),
+		Write: cCtx.Duration("write-timeout"),
+		Idle:  cCtx.Duration("idle-timeout"),
+	}
 
-	ocspCertPath := filepath.Join(cwd, cCtx.String("cert"))
-	w.OCSPCert, err = utils.ReadPEMCertificate(ocspCertPath)
+	w.Limits = handler.Limits{
+		MaxRequestSize: cCtx.Int64("max-request-size"),
+		Rate:           cCtx.Float64("rate-limit"),
+		Burst:          cCtx.Int("rate-burst"),
+	}
+	w.Limits.Allowlist, err = handler.ParseAllowlist(cCtx.StringSlice("rate-limit-allowlist"))
 	if err != nil {
 		return err
 	}
 
-	ocspKeyPath := filepath.Join(cwd, cCtx.String("key"))
-	w.OCSPPrivateKey, err = utils.ReadPEMPrivateKey(ocspKeyPath)
+	w.AdminAuth = handler.AdminAuth{
+		Tokens:      cCtx.StringSlice("admin-token"),
+		ClientCert:  cCtx.Bool("admin-client-cert"),
+		ClientNames: cCtx.StringSlice("admin-client-names"),
+	}
+	w.AdminPort = cCtx.String("admin-port")
+	w.AdminInsecure = cCtx.Bool("admin-insecure")
+	w.DebugRoute = cCtx.Bool("debug-route")
+	w.Audit = audit.Config{
+		Sink:          cCtx.String("audit-sink"),
+		MaxSize:       cCtx.Int("audit-max-size"),
+		MaxBackups:    cCtx.Int("audit-max-backups"),
+		BatchSize:     cCtx.Int("audit-batch-size"),
+		FlushInterval: cCtx.Duration("audit-flush-interval"),
+		OnFull:        cCtx.String("audit-on-full"),
+		BlockTimeout:  cCtx.Duration("audit-block-timeout"),
+	}
+	if err := w.Audit.Validate(); err != nil {
+		return err
+	}
+	w.Tracing = tracing.Config{
+		Exporter:    cCtx.String("trace-exporter"),
+		Endpoint:    cCtx.String("trace-endpoint"),
+		Insecure:    cCtx.Bool("trace-insecure"),
+		SampleRatio: cCtx.Float64("trace-sample-ratio"),
+	}
+	w.DBPool = models.PoolConfig{
+		MaxOpenConns:    cCtx.Int("db-max-open-conns"),
+		MaxIdleConns:    cCtx.Int("db-max-idle-conns"),
+		ConnMaxIdleTime: cCtx.Duration("db-conn-max-idle-time"),
+		ConnMaxLifetime: cCtx.Duration("db-conn-max-lifetime"),
+	}
+
+	cwd, err := GetWd()
 	if err != nil {
 		return err
 	}
 
+	w.CACertFile = ResolvePath(cwd, cCtx.String("cacert"))
+	w.OCSPCertFile = ResolvePath(cwd, cCtx.String("cert"))
+	w.OCSPKeyFile = ResolvePath(cwd, cCtx.String("key"))
+
+	w.BindAddress = cCtx.String("address")
 	w.Port = cCtx.String("port")
+	w.Audit.File = ResolvePath(cwd, cCtx.String("audit-file"))
+
+	w.TLSOptions = server.TLSOptions{}
+	if cCtx.String("tls-cert") != "" {
+		w.TLSOptions = server.TLSOptions{
+			CertFile:     ResolvePath(cwd, cCtx.String("tls-cert")),
+			KeyFile:      ResolvePath(cwd, cCtx.String("tls-key")),
+			ClientAuth:   cCtx.String("tls-client-auth"),
+			MinVersion:   cCtx.String("tls-min-version"),
+			CipherPolicy: cCtx.String("tls-cipher-policy"),
+		}
+		if cCtx.String("tls-client-ca") != "" {
+			w.TLSOptions.ClientCAFile = ResolvePath(cwd, cCtx.String("tls-client-ca"))
+		}
+		w.PlainPort = cCtx.String("plain-port")
+	}
+
+	// any certificate of the TLS client CA, e.g. the one of an agent, must
+	// not be an admin credential
+	w.AdminClientCAFile = ""
+	if cCtx.String("admin-client-ca") != "" {
+		w.AdminClientCAFile = ResolvePath(cwd, cCtx.String("admin-client-ca"))
+	}
+	if w.AdminAuth.ClientCert && w.AdminClientCAFile == "" && len(w.AdminAuth.ClientNames) == 0 {
+		return errors.New("--admin-client-cert needs --admin-client-ca or --admin-client-names")
+	}
+	if w.AdminClientCAFile != "" && w.AdminPort == "" && w.TLSOptions.ClientCAFile != "" {
+		return errors.New("--admin-client-ca needs --admin-port when --tls-client-ca verifies the clients of the OCSP port")
+	}
+	if w.AdminAuth.Enabled() && w.TLSOptions.CertFile == "" && !w.AdminInsecure && !isLoopback(w.BindAddress) {
+		return errors.New("the admin API needs --tls-cert unless --address is a loopback address or --admin-insecure is set")
+	}
 
 	return nil
 }
+
+// isLoopback reports whether host only accepts local connections, an empty
+// host binds every interface
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ResolvePath joins relative paths with dir and keeps absolute ones
+func ResolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -1,72 +1,214 @@
 package common
 
 import (
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
+	"github.com/scncore/scncore-ocsp-responder/internal/server"
 	"github.com/scncore/utils"
+	"github.com/urfave/cli/v2"
 	"gopkg.in/ini.v1"
 )
 
-func (w *Worker) GenerateOCSPResponderConfig() error {
-	var err error
+// configKeys maps the flags to their keys in the ini config file
+var configKeys = map[string]string{
+	"cacert":                "Certificates.CACert",
+	"cert":                  "Certificates.OCSPCert",
+	"key":                   "Certificates.OCSPKey",
+	"address":               "OCSP.BindAddress",
+	"port":                  "OCSP.OCSPPort",
+	"tls-cert":              "OCSP.TLSCert",
+	"tls-key":               "OCSP.TLSKey",
+	"tls-client-ca":         "OCSP.TLSClientCA",
+	"tls-client-auth":       "OCSP.TLSClientAuth",
+	"tls-min-version":       "OCSP.TLSMinVersion",
+	"tls-cipher-policy":     "OCSP.TLSCipherPolicy",
+	"plain-port":            "OCSP.OCSPPlainPort",
+	"admin-port":            "OCSP.AdminPort",
+	"admin-token":           "OCSP.AdminTokens",
+	"admin-client-cert":     "OCSP.AdminClientCert",
+	"admin-client-ca":       "OCSP.AdminClientCA",
+	"admin-insecure":        "OCSP.AdminInsecure",
+	"admin-client-names":    "OCSP.AdminClientNames",
+	"lookup-timeout":        "OCSP.DBLookupTimeout",
+	"next-update":           "OCSP.NextUpdate",
+	"this-update-precision": "OCSP.ThisUpdatePrecision",
+	"shutdown-timeout":      "OCSP.ShutdownTimeout",
+	"read-timeout":          "OCSP.ReadTimeout",
+	"write-timeout":         "OCSP.WriteTimeout",
+	"idle-timeout":          "OCSP.IdleTimeout",
+	"max-request-size":      "OCSP.MaxRequestSize",
+	"rate-limit":            "OCSP.RateLimit",
+	"rate-burst":            "OCSP.RateBurst",
+	"rate-limit-allowlist":  "OCSP.RateLimitAllowlist",
+	"db-max-open-conns":     "OCSP.DBMaxOpenConns",
+	"db-max-idle-conns":     "OCSP.DBMaxIdleConns",
+	"db-conn-max-idle-time": "OCSP.DBConnMaxIdleTime",
+	"db-conn-max-lifetime":  "OCSP.DBConnMaxLifetime",
+	"debug-route":           "OCSP.DebugRoute",
+	"audit-sink":            "OCSP.AuditSink",
+	"audit-file":            "OCSP.AuditFile",
+	"audit-max-size":        "OCSP.AuditMaxSize",
+	"audit-max-backups":     "OCSP.AuditMaxBackups",
+	"audit-batch-size":      "OCSP.AuditBatchSize",
+	"audit-flush-interval":  "OCSP.AuditFlushInterval",
+	"audit-on-full":         "OCSP.AuditOnFull",
+	"audit-block-timeout":   "OCSP.AuditBlockTimeout",
+	"trace-exporter":        "OCSP.TraceExporter",
+	"trace-endpoint":        "OCSP.TraceEndpoint",
+	"trace-insecure":        "OCSP.TraceInsecure",
+	"trace-sample-ratio":    "OCSP.TraceSampleRatio",
+	"log-level":             "OCSP.LogLevel",
+	"log-format":            "OCSP.LogFormat",
+	"debug":                 "OCSP.Debug",
+}
 
-	// Get config file location
-	configFile := utils.GetConfigFile()
+// pathFlags hold paths, relative paths of the config file are resolved
+// against its directory
+var pathFlags = []string{"cacert", "cert", "key", "tls-cert", "tls-key", "tls-client-ca", "admin-client-ca", "audit-file"}
 
-	// Get new OCSP Responder
-	w.DBUrl, err = utils.CreatePostgresDatabaseURL()
+// GenerateOCSPResponderConfig loads the config of the services, which is
+// read the same way as the config of the start command
+func (w *Worker) GenerateOCSPResponderConfig() error {
+	cCtx, err := NewConfigContext(os.Args[1:])
 	if err != nil {
-		log.Printf("[ERROR]: %v", err)
 		return err
 	}
+	return w.GenerateOCSPResponderConfigFromCLI(cCtx)
+}
+
+// NewConfigContext parses args with the responder flags, so callers
+// without a command, like the services, share the config of start
+func NewConfigContext(args []string) (*cli.Context, error) {
+	flags := OCSPResponderFlags()
+
+	set := flag.NewFlagSet("scncore-ocsp-responder", flag.ContinueOnError)
+	for _, f := range flags {
+		if err := f.Apply(set); err != nil {
+			return nil, err
+		}
+	}
+	if err := set.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cCtx := cli.NewContext(nil, set, nil)
+	cCtx.Command.Flags = flags
+	return cCtx, nil
+}
+
+// applyConfigFile sets the flags that weren't set on the command line or
+// by an environment variable from the ini config file. It returns the path
+// of the file read, which is empty if there's none
+func applyConfigFile(cCtx *cli.Context) (string, error) {
+	configFile := cCtx.String("config")
+	if configFile == "" {
+		// the scncore config file is optional
+		configFile = utils.GetConfigFile()
+		if _, err := os.Stat(configFile); err != nil {
+			return "", nil
+		}
+	}
 
-	// Open ini file
 	cfg, err := ini.Load(configFile)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	key, err := cfg.Section("Certificates").GetKey("CACert")
-	if err != nil {
-		return err
+	boolFlags := []string{}
+	for _, f := range cCtx.Command.Flags {
+		if b, ok := f.(*cli.BoolFlag); ok {
+			boolFlags = append(boolFlags, b.Name)
+		}
 	}
 
-	w.CACert, err = utils.ReadPEMCertificate(key.String())
-	if err != nil {
-		log.Printf("[ERROR]: could not read CA certificate in %s", key.String())
-		return err
+	for name, key := range configKeys {
+		section, key, _ := strings.Cut(key, ".")
+		if cCtx.IsSet(name) || !cfg.Section(section).HasKey(key) {
+			continue
+		}
+
+		value := cfg.Section(section).Key(key).String()
+		if slices.Contains(boolFlags, name) {
+			// ini booleans also accept yes, on and their opposites
+			value = strconv.FormatBool(cfg.Section(section).Key(key).MustBool(false))
+		}
+		if slices.Contains(pathFlags, name) && value != "" && !filepath.IsAbs(value) {
+			value = filepath.Join(filepath.Dir(configFile), value)
+		}
+		if err := cCtx.Set(name, value); err != nil {
+			return "", fmt.Errorf("invalid value for %s in %s: %v", key, configFile, err)
+		}
 	}
 
-	key, err = cfg.Section("Certificates").GetKey("OCSPCert")
-	if err != nil {
-		return err
+	// Read replicas are optional and listed after the primary, which is
+	// DBUrl or else the database of the scncore config file
+	if !cCtx.IsSet("dburl") {
+		ocsp := cfg.Section("OCSP")
+		dbUrl := ocsp.Key("DBUrl").String()
+		if dbUrl == "" {
+			dbUrl, err = utils.CreatePostgresDatabaseURL()
+			if err != nil {
+				return "", err
+			}
+		}
+		dbUrls := append([]string{dbUrl}, ocsp.Key("DBReplicaUrls").Strings(",")...)
+		if err := cCtx.Set("dburl", strings.Join(dbUrls, ",")); err != nil {
+			return "", err
+		}
 	}
 
-	w.OCSPCert, err = utils.ReadPEMCertificate(key.String())
+	return configFile, nil
+}
+
+// LoadCertificates reads the CA certificate, the OCSP signing certificate
+// and key and the TLS settings from the paths of the config
+func (w *Worker) LoadCertificates() error {
+	var err error
+
+	w.CACert, err = utils.ReadPEMCertificate(w.CACertFile)
 	if err != nil {
-		log.Println("[ERROR]: could not read OCSP certificate")
+		slog.Error("could not read CA certificate", "path", w.CACertFile)
 		return err
 	}
 
-	key, err = cfg.Section("Certificates").GetKey("OCSPKey")
+	w.OCSPCert, err = utils.ReadPEMCertificate(w.OCSPCertFile)
 	if err != nil {
+		slog.Error("could not read OCSP certificate", "path", w.OCSPCertFile)
 		return err
 	}
 
-	w.OCSPPrivateKey, err = utils.ReadPEMPrivateKey(key.String())
+	w.OCSPPrivateKey, err = ReadPrivateKey(w.OCSPKeyFile)
 	if err != nil {
-		log.Println("[ERROR]: could not read OCSP private key")
+		slog.Error("could not read OCSP private key", "path", w.OCSPKeyFile)
 		return err
 	}
 
-	key, err = cfg.Section("OCSP").GetKey("OCSPPort")
-	if err != nil {
-		return err
+	w.AdminAuth.ClientCAs = nil
+	if w.AdminClientCAFile != "" {
+		w.AdminAuth.ClientCAs, err = server.LoadCertPool(w.AdminClientCAFile)
+		if err != nil {
+			slog.Error("could not read the admin client CA bundle", "path", w.AdminClientCAFile, "reason", err)
+			return err
+		}
 	}
 
-	w.Port = key.String()
+	w.TLSConfig = nil
+	if w.TLSOptions.CertFile != "" {
+		w.TLSConfig, err = server.NewTLSConfig(w.TLSOptions)
+		if err != nil {
+			slog.Error("could not configure TLS", "reason", err)
+			return err
+		}
+	}
 
 	return nil
 }
@@ -74,6 +216,8 @@ func (w *Worker) GenerateOCSPResponderConfig() error {
 func (w *Worker) StartGenerateOCSPResponderConfigJob() error {
 	var err error
 
+	notify("STATUS=waiting for a valid config")
+
 	// Create task for getting the worker config
 	w.ConfigJob, err = w.TaskScheduler.NewJob(
 		gocron.DurationJob(
@@ -83,11 +227,12 @@ func (w *Worker) StartGenerateOCSPResponderConfigJob() error {
 			func() {
 				err = w.GenerateOCSPResponderConfig()
 				if err != nil {
-					log.Printf("[ERROR]: could not generate config for OCSP responder, reason: %v", err)
+					slog.Error("could not generate config for OCSP responder", "reason", err)
+					notify("STATUS=waiting for a valid config: " + err.Error())
 					return
 				}
 
-				log.Println("[INFO]: responder's config has been successfully generated")
+				slog.Info("responder's config has been successfully generated")
 				if err := w.TaskScheduler.RemoveJob(w.ConfigJob.ID()); err != nil {
 					return
 				}
@@ -96,9 +241,9 @@ func (w *Worker) StartGenerateOCSPResponderConfigJob() error {
 		),
 	)
 	if err != nil {
-		log.Fatalf("[FATAL]: could not start the generate OCSP responder config job: %v", err)
-		return err
+		slog.Error("could not start the generate OCSP responder config job", "reason", err)
+		os.Exit(1)
 	}
-	log.Printf("[INFO]: new generate OCSP responder config job has been scheduled every %d minute", 1)
+	slog.Info("new generate OCSP responder config job has been scheduled", "every", time.Minute)
 	return nil
 }
@@ -0,0 +1,284 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/scncore/utils"
+)
+
+// clearFlagEnv unsets the environment variables of the responder flags so
+// the environment of the test runner doesn't leak into the config
+func clearFlagEnv(t *testing.T) {
+	t.Helper()
+	for _, f := range OCSPResponderFlags() {
+		env, ok := f.(interface{ GetEnvVars() []string })
+		if !ok {
+			continue
+		}
+		for _, name := range env.GetEnvVars() {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestReadOCSPResponderConfigFromCLI(t *testing.T) {
+	exeDir, err := GetWd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	absCACert := filepath.Join(t.TempDir(), "ca.pem")
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		ini  string
+		// check gets the directory of the ini file
+		check func(t *testing.T, w *Worker, iniDir string)
+	}{
+		{
+			name: "defaults",
+			ini:  "[OCSP]\nDBUrl = postgres://primary/scncore\n",
+			check: func(t *testing.T, w *Worker, iniDir string) {
+				wantString(t, "CACertFile", w.CACertFile, filepath.Join(exeDir, "certificates", "ca.cer"))
+				wantString(t, "Audit.File", w.Audit.File, filepath.Join(exeDir, "audit.log"))
+				wantString(t, "Port", w.Port, "8000")
+				wantInt(t, "Limits.Burst", w.Limits.Burst, 20)
+				wantString(t, "LogLevel", w.LogLevel, "info")
+			},
+		},
+		{
+			name: "ini over defaults",
+			ini: "[Certificates]\nCACert = certs/ca.pem\n" +
+				"[OCSP]\nDBUrl = postgres://primary/scncore\nOCSPPort = 9000\nRateBurst = 5\nAuditFile = logs/audit.log\n",
+			check: func(t *testing.T, w *Worker, iniDir string) {
+				wantString(t, "CACertFile", w.CACertFile, filepath.Join(iniDir, "certs", "ca.pem"))
+				wantString(t, "Audit.File", w.Audit.File, filepath.Join(iniDir, "logs", "audit.log"))
+				wantString(t, "Port", w.Port, "9000")
+				wantInt(t, "Limits.Burst", w.Limits.Burst, 5)
+			},
+		},
+		{
+			name: "absolute ini paths are kept",
+			ini:  "[Certificates]\nCACert = " + absCACert + "\n[OCSP]\nDBUrl = postgres://primary/scncore\n",
+			check: func(t *testing.T, w *Worker, iniDir string) {
+				wantString(t, "CACertFile", w.CACertFile, absCACert)
+			},
+		},
+		{
+			name: "env over ini",
+			env:  map[string]string{"CA_CERT_FILENAME": "env/ca.pem", "OCSP_PORT": "9100", "RATE_BURST": "7"},
+			ini: "[Certificates]\nCACert = certs/ca.pem\n" +
+				"[OCSP]\nDBUrl = postgres://primary/scncore\nOCSPPort = 9000\nRateBurst = 5\n",
+			check: func(t *testing.T, w *Worker, iniDir string) {
+				wantString(t, "CACertFile", w.CACertFile, filepath.Join(exeDir, "env", "ca.pem"))
+				wantString(t, "Port", w.Port, "9100")
+				wantInt(t, "Limits.Burst", w.Limits.Burst, 7)
+			},
+		},
+		{
+			name: "flag over env",
+			args: []string{"--cacert", "flag/ca.pem", "--port", "9200", "--rate-burst", "9"},
+			env:  map[string]string{"CA_CERT_FILENAME": "env/ca.pem", "OCSP_PORT": "9100", "RATE_BURST": "7"},
+			ini: "[Certificates]\nCACert = certs/ca.pem\n" +
+				"[OCSP]\nDBUrl = postgres://primary/scncore\nOCSPPort = 9000\nRateBurst = 5\n",
+			check: func(t *testing.T, w *Worker, iniDir string) {
+				wantString(t, "CACertFile", w.CACertFile, filepath.Join(exeDir, "flag", "ca.pem"))
+				wantString(t, "Port", w.Port, "9200")
+				wantInt(t, "Limits.Burst", w.Limits.Burst, 9)
+			},
+		},
+		{
+			name: "ini booleans",
+			ini:  "[OCSP]\nDBUrl = postgres://primary/scncore\nDebug = yes\nTraceInsecure = on\nDebugRoute = 0\n",
+			check: func(t *testing.T, w *Worker, iniDir string) {
+				wantString(t, "LogLevel", w.LogLevel, "debug")
+				wantBool(t, "Tracing.Insecure", w.Tracing.Insecure, true)
+				wantBool(t, "DebugRoute", w.DebugRoute, false)
+			},
+		},
+		{
+			name: "env booleans over ini",
+			env:  map[string]string{"DEBUG": "false", "TRACE_INSECURE": "false"},
+			ini:  "[OCSP]\nDBUrl = postgres://primary/scncore\nDebug = yes\nTraceInsecure = on\n",
+			check: func(t *testing.T, w *Worker, iniDir string) {
+				wantString(t, "LogLevel", w.LogLevel, "info")
+				wantBool(t, "Tracing.Insecure", w.Tracing.Insecure, false)
+			},
+		},
+		{
+			name: "ini primary and replicas",
+			ini:  "[OCSP]\nDBUrl = postgres://primary/scncore\nDBReplicaUrls = postgres://replica1/scncore, postgres://replica2/scncore\n",
+			check: func(t *testing.T, w *Worker, iniDir string) {
+				wantStrings(t, "DBUrls", w.DBUrls, []string{"postgres://primary/scncore", "postgres://replica1/scncore", "postgres://replica2/scncore"})
+			},
+		},
+		{
+			name: "env database url replaces the ini primary and replicas",
+			env:  map[string]string{"DATABASE_URL": "postgres://env/scncore"},
+			ini:  "[OCSP]\nDBUrl = postgres://primary/scncore\nDBReplicaUrls = postgres://replica1/scncore\n",
+			check: func(t *testing.T, w *Worker, iniDir string) {
+				wantStrings(t, "DBUrls", w.DBUrls, []string{"postgres://env/scncore"})
+			},
+		},
+		{
+			name: "flag database urls over env",
+			args: []string{"--dburl", "postgres://flag/scncore,postgres://flag-replica/scncore"},
+			env:  map[string]string{"DATABASE_URL": "postgres://env/scncore"},
+			ini:  "[OCSP]\nDBUrl = postgres://primary/scncore\n",
+			check: func(t *testing.T, w *Worker, iniDir string) {
+				wantStrings(t, "DBUrls", w.DBUrls, []string{"postgres://flag/scncore", "postgres://flag-replica/scncore"})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearFlagEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			iniDir := t.TempDir()
+			iniFile := filepath.Join(iniDir, "ocsp.ini")
+			if err := os.WriteFile(iniFile, []byte(tt.ini), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			cCtx, err := NewConfigContext(append([]string{"--config", iniFile}, tt.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := &Worker{LogOutput: os.Stderr}
+			if err := w.ReadOCSPResponderConfigFromCLI(cCtx); err != nil {
+				t.Fatal(err)
+			}
+			wantString(t, "ConfigFile", w.ConfigFile, iniFile)
+			tt.check(t, w, iniDir)
+		})
+	}
+}
+
+func TestReadOCSPResponderConfigFromCLIInvalidIniValue(t *testing.T) {
+	clearFlagEnv(t)
+
+	iniFile := filepath.Join(t.TempDir(), "ocsp.ini")
+	if err := os.WriteFile(iniFile, []byte("[OCSP]\nDBUrl = postgres://primary/scncore\nRateBurst = many\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cCtx, err := NewConfigContext([]string{"--config", iniFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Worker{LogOutput: os.Stderr}
+	if err := w.ReadOCSPResponderConfigFromCLI(cCtx); err == nil {
+		t.Fatal("expected an error for an invalid RateBurst")
+	}
+}
+
+func TestReadOCSPResponderConfigFromCLIMissingDatabaseURL(t *testing.T) {
+	clearFlagEnv(t)
+	if _, err := os.Stat(utils.GetConfigFile()); err == nil {
+		t.Skip("the scncore config file of this host provides a database url")
+	}
+
+	cCtx, err := NewConfigContext(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Worker{LogOutput: os.Stderr}
+	if err := w.ReadOCSPResponderConfigFromCLI(cCtx); err == nil {
+		t.Fatal("expected an error without a database url")
+	}
+}
+
+func TestReadOCSPResponderConfigFromCLIAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{"plain HTTP on every interface", []string{"--admin-token", "secret"}, true},
+		{"plain HTTP on loopback", []string{"--admin-token", "secret", "--address", "127.0.0.1"}, false},
+		{"plain HTTP on localhost", []string{"--admin-token", "secret", "--address", "localhost"}, false},
+		{"plain HTTP allowed", []string{"--admin-token", "secret", "--admin-insecure"}, false},
+		{"client certificates of any client", []string{"--admin-client-cert", "--address", "::1"}, true},
+		{"client certificates of allowed names", []string{"--admin-client-cert", "--admin-client-names", "ops", "--address", "::1"}, false},
+		{"no admin API", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearFlagEnv(t)
+
+			iniFile := filepath.Join(t.TempDir(), "ocsp.ini")
+			if err := os.WriteFile(iniFile, []byte("[OCSP]\nDBUrl = postgres://primary/scncore\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			cCtx, err := NewConfigContext(append([]string{"--config", iniFile}, tt.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := &Worker{LogOutput: os.Stderr}
+			err = w.ReadOCSPResponderConfigFromCLI(cCtx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadOCSPResponderConfigFromCLI() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	dir := t.TempDir()
+	abs := filepath.Join(t.TempDir(), "ca.pem")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"ca.pem", filepath.Join(dir, "ca.pem")},
+		{filepath.Join("certificates", "ca.cer"), filepath.Join(dir, "certificates", "ca.cer")},
+		{abs, abs},
+	}
+
+	for _, tt := range tests {
+		if got := ResolvePath(dir, tt.path); got != tt.want {
+			t.Errorf("ResolvePath(%q, %q) = %q, want %q", dir, tt.path, got, tt.want)
+		}
+	}
+}
+
+func wantString(t *testing.T, name, got, want string) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %q, want %q", name, got, want)
+	}
+}
+
+func wantStrings(t *testing.T, name string, got, want []string) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Errorf("%s = %q, want %q", name, got, want)
+	}
+}
+
+func wantInt(t *testing.T, name string, got, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %d, want %d", name, got, want)
+	}
+}
+
+func wantBool(t *testing.T, name string, got, want bool) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %t, want %t", name, got, want)
+	}
+}
@@ -1,12 +1,16 @@
 package common
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
+	"github.com/scncore/scncore-ocsp-responder/internal/audit"
+	"github.com/scncore/scncore-ocsp-responder/internal/metrics"
 	"github.com/scncore/scncore-ocsp-responder/internal/models"
 	"github.com/scncore/scncore-ocsp-responder/internal/server"
 )
@@ -14,14 +18,15 @@ import (
 func (w *Worker) StartDBConnectJob() error {
 	var err error
 
-	w.Model, err = models.New(w.DBUrl)
+	notify("STATUS=connecting with the database")
+	w.Model, err = models.New(w.DBUrls, w.DBPool)
+	recordDBConnectAttempt(err)
 	if err == nil {
-		log.Println("[INFO]: connection established with database")
-
-		w.StartOCSPResponderWebService()
-		return nil
+		slog.Info("connection established with database")
+		return w.onDBConnected()
 	}
-	log.Printf("[ERROR]: could not connect with database %v", err)
+	slog.Error("could not connect with database", "reason", err)
+	notify("STATUS=waiting for the database: " + err.Error())
 
 	// Create task for running the agent
 	w.DBConnectJob, err = w.TaskScheduler.NewJob(
@@ -30,43 +35,160 @@ func (w *Worker) StartDBConnectJob() error {
 		),
 		gocron.NewTask(
 			func() {
-				w.Model, err = models.New(w.DBUrl)
+				w.Model, err = models.New(w.DBUrls, w.DBPool)
+				recordDBConnectAttempt(err)
 				if err != nil {
-					log.Printf("[ERROR]: could not connect with database %v", err)
+					slog.Error("could not connect with database", "reason", err)
+					notify("STATUS=waiting for the database: " + err.Error())
 					return
 				}
-				log.Println("[INFO]: connection established with database")
+				slog.Info("connection established with database")
 
 				if err := w.TaskScheduler.RemoveJob(w.DBConnectJob.ID()); err != nil {
 					return
 				}
 
-				w.StartOCSPResponderWebService()
+				if err := w.onDBConnected(); err != nil {
+					slog.Error("the OCSP responder can't serve requests", "reason", err)
+					w.fail(err)
+				}
 			},
 		),
 	)
 	if err != nil {
-		log.Fatalf("[FATAL]: could not start the DB connect job: %v", err)
+		slog.Error("could not start the DB connect job", "reason", err)
+		os.Exit(1)
+	}
+	slog.Info("new DB connect job has been scheduled", "every", 30*time.Second)
+	return nil
+}
+
+// onDBConnected hands the model to the web server, which is started now if
+// it wasn't already serving health and readiness probes
+func (w *Worker) onDBConnected() error {
+	if err := w.checkSchema(); err != nil {
+		return err
+	}
+
+	metrics.SetDatabaseStats(w.Model.Stats)
+
+	w.StartDBHealthCheckJob()
+	if w.WebServer == nil {
+		w.StartOCSPResponderWebService()
+	}
+	w.WebServer.Handler.SetModel(w.Model)
+	w.notifyReady()
+	return nil
+}
+
+func recordDBConnectAttempt(err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.DBConnectAttempts.WithLabelValues(result).Inc()
+}
+
+// checkSchema refuses to serve requests if the database schema isn't
+// compatible, the responder never migrates the schema by itself. Without
+// the history table revocation changes are still made but not recorded
+func (w *Worker) checkSchema() error {
+	ctx := context.Background()
+	if err := w.Model.CheckSchema(ctx, models.SchemaOptions{Audit: w.Audit.InDatabase()}); err != nil {
 		return err
 	}
-	log.Printf("[INFO]: new DB connect job has been scheduled every %d seconds", 30)
+	if err := w.Model.CheckSchema(ctx, models.SchemaOptions{History: true}); err != nil {
+		slog.Warn("revocation changes won't be recorded in the history", "reason", err)
+		w.Model.DisableHistory = true
+	}
 	return nil
 }
 
+func (w *Worker) StartDBHealthCheckJob() {
+	var err error
+
+	// Create task for checking the database backends, so lookups fail over
+	// to a reachable backend and recover when the original one comes back
+	w.DBHealthJob, err = w.TaskScheduler.NewJob(
+		gocron.DurationJob(
+			time.Duration(time.Duration(15*time.Second)),
+		),
+		gocron.NewTask(
+			func() {
+				if !w.Model.HealthCheck(context.Background()) {
+					slog.Error("no database backend is reachable")
+				}
+			},
+		),
+	)
+	if err != nil {
+		slog.Error("could not start the DB health check job", "reason", err)
+		return
+	}
+	slog.Info("new DB health check job has been scheduled", "every", 15*time.Second)
+}
+
 func (w *Worker) StartOCSPResponderWebService() {
-	log.Println("[INFO]: launching server")
+	slog.Info("launching server")
 
-	port := ":8000"
+	port := "8000"
 	if w.Port != "" {
-		port = fmt.Sprintf(":%s", w.Port)
+		port = w.Port
+	}
+	w.WebServer = server.New(w.Model, net.JoinHostPort(w.BindAddress, port), w.CACert, w.OCSPCert, w.OCSPPrivateKey)
+	metrics.SetCertificates(w.CACert, w.OCSPCert)
+	if w.LookupTimeout > 0 {
+		w.WebServer.Handler.LookupTimeout = w.LookupTimeout
+	}
+	if w.Validity.NextUpdate > 0 {
+		w.WebServer.Handler.Validity = w.Validity
+	}
+	w.WebServer.Handler.Limits = w.Limits
+	w.WebServer.Timeouts = w.Timeouts
+	w.WebServer.Handler.AdminAuth = w.AdminAuth
+	if w.AdminPort != "" {
+		w.WebServer.AdminAddress = net.JoinHostPort(w.BindAddress, w.AdminPort)
+	}
+	w.WebServer.Handler.Jobs = w.JobsState
+	w.WebServer.Handler.DebugRoute = w.DebugRoute
+	if w.Audit.Enabled() {
+		h := w.WebServer.Handler
+		auditLog, err := audit.New(w.Audit, func() audit.Store {
+			if model := h.Model(); model != nil {
+				return model
+			}
+			return nil
+		})
+		if err != nil {
+			slog.Error("could not start the audit log, signed responses won't be audited", "reason", err)
+		} else {
+			w.AuditLog = auditLog
+			h.Audit = auditLog
+			metrics.SetAuditDropped(auditLog.Dropped)
+			slog.Info("signed responses are audited", "sink", w.Audit.Sink)
+		}
+	}
+	w.WebServer.TLSConfig = w.TLSConfig
+	if w.TLSConfig != nil && w.PlainPort != "" {
+		w.WebServer.PlainAddress = net.JoinHostPort(w.BindAddress, w.PlainPort)
+	}
+
+	w.WebServer.Listening = func() {
+		w.listening.Store(true)
+		w.notifyReady()
 	}
-	w.WebServer = server.New(w.Model, port, w.CACert, w.OCSPCert, w.OCSPPrivateKey)
+	w.WebServer.Failed = w.fail
 
+	// the servers are built before Serve runs so Shutdown never races with it
+	w.WebServer.Prepare()
+	w.serverStarted.Store(true)
 	go func() {
 		if err := w.WebServer.Serve(); err != http.ErrServerClosed {
-			log.Printf("[ERROR]: the server has stopped, reason: %v", err.Error())
+			slog.Error("the server has stopped", "reason", err)
+			w.fail(err)
 		}
+		w.listening.Store(false)
 	}()
 
-	log.Println("[INFO]: OCSP responder is running")
+	slog.Info("OCSP responder is running", "address", w.WebServer.Address)
 }
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"github.com/go-co-op/gocron/v2"
+	"github.com/scncore/scncore-ocsp-responder/internal/server/handler"
+)
+
+// JobsState reports the scheduled jobs for the health report. Jobs that
+// removed themselves after succeeding are reported as done
+func (w *Worker) JobsState() []handler.JobState {
+	jobs := []struct {
+		name string
+		job  gocron.Job
+	}{
+		{"config", w.ConfigJob},
+		{"db-connect", w.DBConnectJob},
+		{"db-health", w.DBHealthJob},
+		{"watchdog", w.WatchdogJob},
+	}
+
+	states := []handler.JobState{}
+	for _, j := range jobs {
+		if j.job == nil {
+			continue
+		}
+
+		state := handler.JobState{Name: j.name, State: "scheduled"}
+		nextRun, err := j.job.NextRun()
+		if err != nil {
+			state.State = "done"
+		} else {
+			state.NextRun = nextRun
+		}
+		if lastRun, err := j.job.LastRun(); err == nil && !lastRun.IsZero() {
+			state.LastRun = lastRun
+		}
+		states = append(states, state)
+	}
+	return states
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/scncore/utils"
+)
+
+// ReadPrivateKey reads a PEM private key able to sign OCSP responses: a
+// PKCS #1 RSA key, a SEC 1 EC key or a PKCS #8 RSA, ECDSA or Ed25519 key
+func ReadPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM private key", path)
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return utils.ReadPEMPrivateKey(path)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s holds a key that can't sign", path)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("%s holds a %s, not a private key", path, block.Type)
+	}
+}
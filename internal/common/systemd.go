@@ -0,0 +1,75 @@
+package common
+
+import (
+	"log/slog"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/scncore/scncore-ocsp-responder/internal/systemd"
+)
+
+// notify sends a state to systemd, failures are only logged as the
+// responder works without a service manager
+func notify(state string) {
+	if err := systemd.Notify(state); err != nil {
+		slog.Warn("could not notify systemd", "state", state, "reason", err)
+	}
+}
+
+// notifyReady tells systemd that the responder serves OCSP requests once
+// the web server listens and the database is connected, whichever happens
+// last
+func (w *Worker) notifyReady() {
+	if w.WebServer == nil || !w.listening.Load() || w.WebServer.Handler.Model() == nil {
+		return
+	}
+	w.ready.Do(func() {
+		notify("READY=1\nSTATUS=serving OCSP requests")
+	})
+}
+
+// StartWatchdogJob pings the systemd watchdog while the responder is
+// healthy, so systemd restarts it if it hangs. It does nothing unless the
+// unit sets WatchdogSec
+func (w *Worker) StartWatchdogJob() {
+	var err error
+
+	interval := systemd.WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	// ping twice per interval so a late run doesn't trigger a restart
+	w.WatchdogJob, err = w.TaskScheduler.NewJob(
+		gocron.DurationJob(
+			interval/2,
+		),
+		gocron.NewTask(
+			func() {
+				if !w.watchdogHealthy() {
+					slog.Warn("the responder is not healthy, the systemd watchdog won't be pinged")
+					return
+				}
+				notify("WATCHDOG=1")
+			},
+		),
+	)
+	if err != nil {
+		slog.Error("could not start the systemd watchdog job", "reason", err)
+		return
+	}
+	slog.Info("new systemd watchdog job has been scheduled", "every", interval/2)
+}
+
+// watchdogHealthy reports whether the web server listens and its signer
+// and CA certificates are valid, so a restart can pick up renewed ones. The
+// database and audit states are ignored as restarting the responder doesn't
+// help when they're down. If the handler is stuck the job is too and the
+// watchdog isn't pinged. Until the web server starts the responder is
+// waiting for its config, which is healthy
+func (w *Worker) watchdogHealthy() bool {
+	if !w.listening.Load() {
+		return !w.serverStarted.Load()
+	}
+	report := w.WebServer.Handler.Report()
+	return report.Signer.Status == "ok" && report.CA.Status == "ok"
+}
@@ -1,65 +1,206 @@
 package common
 
 import (
-	"crypto/rsa"
+	"context"
+	"crypto"
+	"crypto/tls"
 	"crypto/x509"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-co-op/gocron/v2"
+	"github.com/scncore/scncore-ocsp-responder/internal/audit"
+	"github.com/scncore/scncore-ocsp-responder/internal/logging"
 	"github.com/scncore/scncore-ocsp-responder/internal/models"
 	"github.com/scncore/scncore-ocsp-responder/internal/server"
+	"github.com/scncore/scncore-ocsp-responder/internal/server/handler"
+	"github.com/scncore/scncore-ocsp-responder/internal/tracing"
 	"github.com/scncore/utils"
 )
 
+// DefaultShutdownTimeout is how long in-flight requests are waited for when
+// the responder stops
+const DefaultShutdownTimeout = 30 * time.Second
+
 type Worker struct {
-	Model          *models.Model
-	WebServer      *server.WebServer
-	Logger         *utils.scncoreLogger
-	DBConnectJob   gocron.Job
-	ConfigJob      gocron.Job
-	TaskScheduler  gocron.Scheduler
-	DBUrl          string
-	CACert         *x509.Certificate
-	OCSPCert       *x509.Certificate
-	OCSPPrivateKey *rsa.PrivateKey
-	Port           string
+	Model             *models.Model
+	WebServer         *server.WebServer
+	Logger            *utils.scncoreLogger
+	DBConnectJob      gocron.Job
+	DBHealthJob       gocron.Job
+	WatchdogJob       gocron.Job
+	ConfigJob         gocron.Job
+	TaskScheduler     gocron.Scheduler
+	ConfigFile        string
+	DBUrls            []string
+	DBPool            models.PoolConfig
+	LookupTimeout     time.Duration
+	Validity          handler.Validity
+	ShutdownTimeout   time.Duration
+	Limits            handler.Limits
+	AdminAuth         handler.AdminAuth
+	AdminPort         string
+	AdminClientCAFile string
+	AdminInsecure     bool
+	Timeouts          server.Timeouts
+	CACertFile        string
+	OCSPCertFile      string
+	OCSPKeyFile       string
+	CACert            *x509.Certificate
+	OCSPCert          *x509.Certificate
+	OCSPPrivateKey    crypto.Signer
+	BindAddress       string
+	Port              string
+	PlainPort         string
+	TLSOptions        server.TLSOptions
+	TLSConfig         *tls.Config
+	LogLevel          string
+	LogFormat         string
+	LogOutput         io.Writer
+	Tracing           tracing.Config
+	Audit             audit.Config
+	DebugRoute        bool
+	AuditLog          *audit.Logger
+	stopTracing       func(context.Context) error
+	serverStarted     atomic.Bool
+	listening         atomic.Bool
+	ready             sync.Once
+	failed            chan error
 }
 
 func NewWorker(logName string) *Worker {
-	worker := Worker{}
+	worker := Worker{LogOutput: os.Stderr, failed: make(chan error, 1)}
 	if logName != "" {
 		worker.Logger = utils.NewLogger(logName)
+		worker.LogOutput = worker.Logger.LogFile
+	}
+
+	// Log with the defaults until the config has been read
+	if err := logging.Setup(worker.LogOutput, "info", "text"); err != nil {
+		log.Fatalf("could not set up logging: %v", err)
 	}
 
 	return &worker
 }
 
+// SetupLogging applies the log level and format from the config
+func (w *Worker) SetupLogging() error {
+	level := w.LogLevel
+	if level == "" {
+		level = "info"
+	}
+	return logging.Setup(w.LogOutput, level, w.LogFormat)
+}
+
 func (w *Worker) StartWorker() {
+	// Tracing is optional, the responder works without it
+	stopTracing, err := tracing.Setup(context.Background(), w.Tracing)
+	if err != nil {
+		slog.Error("could not set up tracing", "reason", err)
+	} else {
+		w.stopTracing = stopTracing
+	}
+
+	// The watchdog also runs while waiting for the config or the database
+	if w.TaskScheduler != nil {
+		w.StartWatchdogJob()
+	}
+
+	// Serve health and readiness probes while connecting with the database,
+	// if the config isn't available yet the server starts once connected
+	if w.CACert != nil {
+		w.StartOCSPResponderWebService()
+	}
+
 	// Start a job to try to connect with the database
 	if err := w.StartDBConnectJob(); err != nil {
-		log.Printf("[ERROR]: could not start DB connect job, reason: %s", err.Error())
+		slog.Error("the OCSP responder can't serve requests", "reason", err)
+		w.fail(err)
 		return
 	}
 }
 
+// Failed delivers the error that keeps the responder from serving requests,
+// the caller is expected to shut it down
+func (w *Worker) Failed() <-chan error {
+	return w.failed
+}
+
+func (w *Worker) fail(err error) {
+	select {
+	case w.failed <- err:
+	default:
+	}
+}
+
+// StopWorker shuts down the responder, errors are only logged as service
+// managers can't act on them
 func (w *Worker) StopWorker() {
-	if w.Model != nil {
-		w.Model.Close()
+	if err := w.Shutdown(); err != nil {
+		slog.Error(err.Error())
+	}
+}
+
+// Shutdown stops the web server first and waits for in-flight requests,
+// so no lookup hits a closed database client, then stops the scheduler
+// and the database. It returns an error if the requests couldn't be drained
+// before the shutdown timeout
+func (w *Worker) Shutdown() error {
+	var drainErr error
+
+	notify("STOPPING=1")
+
+	if w.WebServer != nil {
+		timeout := w.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = DefaultShutdownTimeout
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := w.WebServer.Shutdown(ctx); err != nil {
+			drainErr = fmt.Errorf("could not drain in-flight requests in %s: %v", timeout, err)
+		}
+		cancel()
 	}
 
 	if w.TaskScheduler != nil {
 		if err := w.TaskScheduler.Shutdown(); err != nil {
-			log.Printf("[ERROR]: could not stop the task scheduler, reason: %s", err.Error())
+			slog.Error("could not stop the task scheduler", "reason", err)
 		}
 	}
 
-	if w.WebServer != nil {
-		w.WebServer.Close()
+	// write the records of the drained requests while the database is open
+	if w.AuditLog != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := w.AuditLog.Close(ctx); err != nil {
+			slog.Error("could not close the audit log", "reason", err)
+		}
+		cancel()
+	}
+
+	if w.Model != nil {
+		w.Model.Close()
+	}
+
+	// flush the spans of the drained requests
+	if w.stopTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := w.stopTracing(ctx); err != nil {
+			slog.Error("could not flush pending spans", "reason", err)
+		}
+		cancel()
 	}
 
-	log.Println("[INFO]: the OCSP responder has stopped")
+	slog.Info("the OCSP responder has stopped")
 	if w.Logger != nil {
 		w.Logger.Close()
 	}
 
+	return drainErr
 }
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"crypto/x509"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/scncore/scncore-ocsp-responder/internal/models"
+)
+
+const namespace = "scncore_ocsp"
+
+var (
+	// Requests counts answered requests by HTTP method and OCSP status,
+	// good, revoked and unknown for responses or the error status
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "OCSP requests answered by method and status.",
+	}, []string{"method", "status"})
+
+	// Duration observes the time spent in each phase of a request: parse,
+	// lookup and sign
+	Duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_phase_duration_seconds",
+		Help:      "Time spent parsing requests, looking up revocations and signing responses.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"phase"})
+
+	// DBConnectAttempts counts attempts to connect with the database by
+	// result, success or failure
+	DBConnectAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_connect_attempts_total",
+		Help:      "Attempts to connect with the database by result.",
+	}, []string{"result"})
+
+	auditDropped = prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_records_dropped_total",
+		Help:      "Audit records dropped because the audit queue was full.",
+	}, func() float64 {
+		if dropped := auditDroppedFunc.Load(); dropped != nil {
+			return float64((*dropped)())
+		}
+		return 0
+	})
+
+	caCert, ocspCert atomic.Pointer[x509.Certificate]
+	dbStats          atomic.Pointer[func() []models.BackendStats]
+	auditDroppedFunc atomic.Pointer[func() uint64]
+
+	certExpiryDesc = prometheus.NewDesc(namespace+"_certificate_expiry_seconds",
+		"Seconds until the certificate expires.", []string{"certificate"}, nil)
+	dbLookupsDesc = prometheus.NewDesc(namespace+"_db_lookups_total",
+		"Revocation lookups served by each database backend.", []string{"backend", "role"}, nil)
+	dbFailuresDesc = prometheus.NewDesc(namespace+"_db_lookup_failures_total",
+		"Revocation lookups that failed on each database backend.", []string{"backend", "role"}, nil)
+	dbHealthyDesc = prometheus.NewDesc(namespace+"_db_backend_healthy",
+		"Whether the database backend passed its last health check.", []string{"backend", "role"}, nil)
+)
+
+func init() {
+	prometheus.MustRegister(Requests, Duration, DBConnectAttempts, auditDropped, collector{})
+}
+
+// ObservePhase records the time spent in a phase since start
+func ObservePhase(phase string, start time.Time) {
+	Duration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+}
+
+// SetCertificates sets the certificates whose expiry is exported
+func SetCertificates(ca, ocsp *x509.Certificate) {
+	caCert.Store(ca)
+	ocspCert.Store(ocsp)
+}
+
+// SetDatabaseStats sets the source of the per-backend lookup counters
+func SetDatabaseStats(stats func() []models.BackendStats) {
+	dbStats.Store(&stats)
+}
+
+// SetAuditDropped sets the source of the dropped audit records counter
+func SetAuditDropped(dropped func() uint64) {
+	auditDroppedFunc.Store(&dropped)
+}
+
+// collector exports values that are read when scraped rather than counted
+// by the metrics package
+type collector struct{}
+
+func (collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- certExpiryDesc
+	ch <- dbLookupsDesc
+	ch <- dbFailuresDesc
+	ch <- dbHealthyDesc
+}
+
+func (collector) Collect(ch chan<- prometheus.Metric) {
+	for name, cert := range map[string]*x509.Certificate{"ca": caCert.Load(), "ocsp": ocspCert.Load()} {
+		if cert != nil {
+			ch <- prometheus.MustNewConstMetric(certExpiryDesc, prometheus.GaugeValue, time.Until(cert.NotAfter).Seconds(), name)
+		}
+	}
+
+	stats := dbStats.Load()
+	if stats == nil {
+		return
+	}
+	for _, b := range (*stats)() {
+		role := "primary"
+		if b.Replica {
+			role = "replica"
+		}
+		healthy := 0.0
+		if b.Healthy {
+			healthy = 1
+		}
+		ch <- prometheus.MustNewConstMetric(dbLookupsDesc, prometheus.CounterValue, float64(b.Lookups), b.Name, role)
+		ch <- prometheus.MustNewConstMetric(dbFailuresDesc, prometheus.CounterValue, float64(b.Failures), b.Name, role)
+		ch <- prometheus.MustNewConstMetric(dbHealthyDesc, prometheus.GaugeValue, healthy, b.Name, role)
+	}
+}
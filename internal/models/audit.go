@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/scncore/scncore-ocsp-responder/internal/audit"
+)
+
+// InsertAuditRecords writes a batch of signed response records in a
+// single transaction
+func (m *Model) InsertAuditRecords(ctx context.Context, records []audit.Record) error {
+	tx, err := m.backends[0].db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO ocsp_response_audit
+		(created_at, serial, issuer, status, reason, this_update, next_update, client_ip, response_sha256, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range records {
+		if _, err := stmt.ExecContext(ctx, r.Time, r.Serial, r.Issuer, r.Status, r.Reason, r.ThisUpdate, r.NextUpdate, r.ClientIP, r.ResponseHash, r.RequestID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SearchAuditRecords returns the signed response records matching the
+// query, newest first so the limit keeps the latest ones
+func (m *Model) SearchAuditRecords(ctx context.Context, q audit.Query) ([]audit.Record, error) {
+	conditions := []string{}
+	args := []any{}
+	where := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if q.Serial != "" {
+		where("serial = $%d", q.Serial)
+	}
+	if q.Issuer != "" {
+		where("upper(issuer) = upper($%d)", q.Issuer)
+	}
+	if q.Status != "" {
+		where("status = $%d", q.Status)
+	}
+	if !q.From.IsZero() {
+		where("created_at >= $%d", q.From)
+	}
+	if !q.To.IsZero() {
+		where("created_at < $%d", q.To)
+	}
+
+	query := `SELECT created_at, serial, issuer, status, reason, this_update, next_update, client_ip, response_sha256, request_id
+		FROM ocsp_response_audit`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	rows, err := m.backends[0].db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []audit.Record{}
+	for rows.Next() {
+		var r audit.Record
+		var reason sql.NullInt64
+		if err := rows.Scan(&r.Time, &r.Serial, &r.Issuer, &r.Status, &reason, &r.ThisUpdate, &r.NextUpdate, &r.ClientIP, &r.ResponseHash, &r.RequestID); err != nil {
+			return nil, err
+		}
+		r.Reason = nullableReason(reason)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
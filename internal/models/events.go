@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	scncore_ent "github.com/scncore/ent"
+)
+
+const (
+	StatusGood    = "good"
+	StatusRevoked = "revoked"
+)
+
+// RevocationEvent is an entry of the append-only revocation history.
+// Reasons are nil when the status is good
+type RevocationEvent struct {
+	ID        int64     `json:"id"`
+	Serial    int64     `json:"serial"`
+	Issuer    string    `json:"issuer"`
+	OldStatus string    `json:"old_status"`
+	OldReason *int      `json:"old_reason,omitempty"`
+	NewStatus string    `json:"new_status"`
+	Reason    *int      `json:"reason,omitempty"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StatusAt is the status the responder would have returned at a time
+type StatusAt struct {
+	Serial int64     `json:"serial"`
+	At     time.Time `json:"at"`
+	Status string    `json:"status"`
+	Reason *int      `json:"reason,omitempty"`
+	// Source tells whether the status comes from the history or, when the
+	// certificate has no history, from the revocation table
+	Source string `json:"source"`
+}
+
+func (m *Model) appendEvent(ctx context.Context, tx *sql.Tx, e RevocationEvent) error {
+	if m.DisableHistory {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO ocsp_revocation_events
+		(serial, issuer, old_status, old_reason, new_status, reason, actor)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		e.Serial, e.Issuer, e.OldStatus, e.OldReason, e.NewStatus, e.Reason, e.Actor)
+	return err
+}
+
+// GetHistory returns the revocation events of a certificate, oldest first
+func (m *Model) GetHistory(ctx context.Context, serial int64) ([]RevocationEvent, error) {
+	rows, err := m.backends[0].db.QueryContext(ctx, `SELECT id, serial, issuer, old_status, old_reason, new_status, reason, actor, created_at
+		FROM ocsp_revocation_events WHERE serial = $1 ORDER BY created_at, id`, serial)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []RevocationEvent{}
+	for rows.Next() {
+		var e RevocationEvent
+		var oldReason, reason sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.Serial, &e.Issuer, &e.OldStatus, &oldReason, &e.NewStatus, &reason, &e.Actor, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.OldReason = nullableReason(oldReason)
+		e.Reason = nullableReason(reason)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// GetStatusAt reconstructs the status of a certificate at a time from its
+// history. Certificates revoked by other scncore components have no history,
+// their status is taken from the revocation table
+func (m *Model) GetStatusAt(ctx context.Context, serial int64, at time.Time) (*StatusAt, error) {
+	status := StatusAt{Serial: serial, At: at, Source: "history"}
+	db := m.backends[0].db
+
+	// the last change before the time tells the status
+	var reason sql.NullInt64
+	err := db.QueryRowContext(ctx, `SELECT new_status, reason FROM ocsp_revocation_events
+		WHERE serial = $1 AND created_at <= $2 ORDER BY created_at DESC, id DESC LIMIT 1`, serial, at).Scan(&status.Status, &reason)
+	if err == nil {
+		status.Reason = nullableReason(reason)
+		return &status, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// otherwise the first change after the time tells what it was before
+	err = db.QueryRowContext(ctx, `SELECT old_status, old_reason FROM ocsp_revocation_events
+		WHERE serial = $1 AND created_at > $2 ORDER BY created_at, id LIMIT 1`, serial, at).Scan(&status.Status, &reason)
+	if err == nil {
+		status.Reason = nullableReason(reason)
+		return &status, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	status.Source = "revocations"
+	status.Status = StatusGood
+	r, err := m.GetRevocation(ctx, serial)
+	if err != nil && !scncore_ent.IsNotFound(err) {
+		return nil, err
+	}
+	if r != nil && !r.Revoked.After(at) {
+		status.Status = StatusRevoked
+		status.Reason = &r.Reason
+	}
+	return &status, nil
+}
+
+func nullableReason(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	reason := int(v.Int64)
+	return &reason
+}
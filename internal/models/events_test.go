@@ -0,0 +1,61 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRevocationEventJSON(t *testing.T) {
+	reason := 1
+	tests := []struct {
+		name      string
+		event     RevocationEvent
+		want      []string
+		wantNoKey []string
+	}{
+		{
+			name:      "revoked",
+			event:     RevocationEvent{Serial: 10, OldStatus: StatusGood, NewStatus: StatusRevoked, Reason: &reason, Actor: "cli"},
+			want:      []string{`"old_status":"good"`, `"new_status":"revoked"`, `"reason":1`},
+			wantNoKey: []string{`"old_reason"`},
+		},
+		{
+			name:      "released",
+			event:     RevocationEvent{Serial: 10, OldStatus: StatusRevoked, OldReason: &reason, NewStatus: StatusGood, Actor: "cli"},
+			want:      []string{`"old_reason":1`, `"new_status":"good"`},
+			wantNoKey: []string{`"reason"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.event.CreatedAt = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+			data, err := json.Marshal(tt.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("%s doesn't contain %s", data, want)
+				}
+			}
+			for _, key := range tt.wantNoKey {
+				if strings.Contains(string(data), key+":") {
+					t.Errorf("%s contains %s, the reason of a good status must be omitted", data, key)
+				}
+			}
+		})
+	}
+}
+
+func TestNullableReason(t *testing.T) {
+	if got := nullableReason(sql.NullInt64{}); got != nil {
+		t.Errorf("nullableReason(NULL) = %d, want nil", *got)
+	}
+	if got := nullableReason(sql.NullInt64{Int64: 6, Valid: true}); got == nil || *got != 6 {
+		t.Errorf("nullableReason(6) = %v, want 6", got)
+	}
+}
@@ -3,8 +3,12 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"os"
+	"log/slog"
+	"net/url"
+	"sync/atomic"
+	"time"
 
 	"entgo.io/ent/dialect"
 	entsql "entgo.io/ent/dialect/sql"
@@ -12,31 +16,154 @@ import (
 	ent "github.com/scncore/ent"
 )
 
+// ErrNoBackend is returned when no database backend could serve a lookup
+var ErrNoBackend = errors.New("no database backend is available")
+
+// Backend is a connection pool against one of the configured databases.
+// The first database URL is the primary, the rest are read replicas.
+type Backend struct {
+	Name     string
+	Replica  bool
+	db       *sql.DB
+	client   *ent.Client
+	healthy  atomic.Bool
+	lookups  atomic.Uint64
+	failures atomic.Uint64
+}
+
+// BackendStats is a snapshot of the counters kept for a backend
+type BackendStats struct {
+	Name     string
+	Replica  bool
+	Healthy  bool
+	Lookups  uint64
+	Failures uint64
+}
+
+// PoolConfig holds the connection pool settings applied to every backend.
+// Zero values keep the database/sql defaults
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxIdleTime time.Duration
+	ConnMaxLifetime time.Duration
+}
+
 type Model struct {
+	// Client is bound to the primary database and must be used for writes
 	Client *ent.Client
+	// DisableHistory skips recording revocation changes, the responder sets
+	// it when the ocsp_revocation_events table is missing
+	DisableHistory bool
+	backends       []*Backend
 }
 
-func New(dbUrl string) (*Model, error) {
+func New(dbUrls []string, pool PoolConfig) (*Model, error) {
 	model := Model{}
 
-	db, err := sql.Open("pgx", dbUrl)
-	if err != nil {
-		return nil, fmt.Errorf("could not connect with Postgres database: %v", err)
+	if len(dbUrls) == 0 {
+		return nil, errors.New("at least one database url is required")
 	}
 
-	model.Client = ent.NewClient(ent.Driver(entsql.OpenDB(dialect.Postgres, db)))
+	for i, dbUrl := range dbUrls {
+		db, err := sql.Open("pgx", dbUrl)
+		if err != nil {
+			model.Close()
+			return nil, fmt.Errorf("could not connect with Postgres database: %v", err)
+		}
+		db.SetMaxOpenConns(pool.MaxOpenConns)
+		if pool.MaxIdleConns > 0 {
+			db.SetMaxIdleConns(pool.MaxIdleConns)
+		}
+		db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+		db.SetConnMaxLifetime(pool.ConnMaxLifetime)
 
-	// TODO Automatic migrations only in development
-	ctx := context.Background()
-	if os.Getenv("ENV") != "prod" {
-		if err := model.Client.Schema.Create(ctx); err != nil {
-			return nil, err
+		b := Backend{
+			Name:    backendName(dbUrl, i),
+			Replica: i > 0,
+			db:      db,
+			client:  ent.NewClient(ent.Driver(entsql.OpenDB(dialect.Postgres, db))),
 		}
+		model.backends = append(model.backends, &b)
+	}
+	model.Client = model.backends[0].client
+
+	if !model.HealthCheck(context.Background()) {
+		model.Close()
+		return nil, ErrNoBackend
 	}
 
 	return &model, nil
 }
 
+// HealthCheck pings every backend and updates its health state. It returns
+// true if at least one backend is reachable
+func (m *Model) HealthCheck(ctx context.Context) bool {
+	available := false
+	for _, b := range m.backends {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := b.db.PingContext(pingCtx)
+		cancel()
+
+		healthy := err == nil
+		if b.healthy.Swap(healthy) != healthy {
+			if healthy {
+				slog.Info("database backend is reachable", "backend", b.Name)
+			} else {
+				slog.Error("database backend is unreachable", "backend", b.Name, "reason", err)
+			}
+		}
+		available = available || healthy
+	}
+	return available
+}
+
+// Stats returns the health state and counters of every backend
+func (m *Model) Stats() []BackendStats {
+	stats := []BackendStats{}
+	for _, b := range m.backends {
+		stats = append(stats, BackendStats{
+			Name:     b.Name,
+			Replica:  b.Replica,
+			Healthy:  b.healthy.Load(),
+			Lookups:  b.lookups.Load(),
+			Failures: b.failures.Load(),
+		})
+	}
+	return stats
+}
+
+// readBackends returns the backends to try for a read, healthy replicas
+// first, then the primary. If none is healthy all of them are returned so
+// a lookup can still succeed before the next health check runs
+func (m *Model) readBackends() []*Backend {
+	candidates := []*Backend{}
+	for _, b := range m.backends[1:] {
+		if b.healthy.Load() {
+			candidates = append(candidates, b)
+		}
+	}
+	if m.backends[0].healthy.Load() {
+		candidates = append(candidates, m.backends[0])
+	}
+
+	if len(candidates) == 0 {
+		return m.backends
+	}
+	return candidates
+}
+
 func (m *Model) Close() {
-	m.Client.Close()
+	for _, b := range m.backends {
+		b.client.Close()
+	}
+}
+
+// backendName returns a name for the backend that doesn't leak credentials
+func backendName(dbUrl string, index int) string {
+	u, err := url.Parse(dbUrl)
+	if err != nil || u.Host == "" {
+		return fmt.Sprintf("backend-%d", index)
+	}
+	return u.Host + u.Path
 }
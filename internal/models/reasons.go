@@ -0,0 +1,72 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// ReasonNames are the CRLReason codes from RFC 5280 section 5.3.1, code 7
+// is not used
+var ReasonNames = map[int]string{
+	ocsp.Unspecified:          "unspecified",
+	ocsp.KeyCompromise:        "keyCompromise",
+	ocsp.CACompromise:         "cACompromise",
+	ocsp.AffiliationChanged:   "affiliationChanged",
+	ocsp.Superseded:           "superseded",
+	ocsp.CessationOfOperation: "cessationOfOperation",
+	ocsp.CertificateHold:      "certificateHold",
+	ocsp.RemoveFromCRL:        "removeFromCRL",
+	ocsp.PrivilegeWithdrawn:   "privilegeWithdrawn",
+	ocsp.AACompromise:         "aACompromise",
+}
+
+// ValidateReason checks that a reason can be used to revoke a certificate.
+// removeFromCRL only exists in delta CRLs, certificates are released
+// from hold by deleting their revocation instead
+func ValidateReason(reason int) error {
+	if _, ok := ReasonNames[reason]; !ok {
+		return fmt.Errorf("%d is not a RFC 5280 reason code", reason)
+	}
+	if reason == ocsp.RemoveFromCRL {
+		return fmt.Errorf("removeFromCRL can't be used to revoke a certificate, release it instead")
+	}
+	return nil
+}
+
+// ParseReason accepts a reason code or its RFC 5280 name
+func ParseReason(value string) (int, error) {
+	reason, err := strconv.Atoi(value)
+	if err != nil {
+		reason = -1
+		for code, name := range ReasonNames {
+			if strings.EqualFold(name, value) {
+				reason = code
+			}
+		}
+		if reason == -1 {
+			names := []string{}
+			for _, name := range ReasonNames {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			return 0, fmt.Errorf("unknown reason %s, use one of %s", value, strings.Join(names, ", "))
+		}
+	}
+
+	if err := ValidateReason(reason); err != nil {
+		return 0, err
+	}
+	return reason, nil
+}
+
+// ReasonName returns the RFC 5280 name of a reason code
+func ReasonName(reason int) string {
+	if name, ok := ReasonNames[reason]; ok {
+		return name
+	}
+	return strconv.Itoa(reason)
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestParseReason(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "1", want: ocsp.KeyCompromise},
+		{value: "keyCompromise", want: ocsp.KeyCompromise},
+		{value: "KEYCOMPROMISE", want: ocsp.KeyCompromise},
+		{value: "certificateHold", want: ocsp.CertificateHold},
+		{value: "0", want: ocsp.Unspecified},
+		{value: "7", wantErr: true},
+		{value: "11", wantErr: true},
+		{value: "removeFromCRL", wantErr: true},
+		{value: "8", wantErr: true},
+		{value: "stolen", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseReason(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReason(%q) error = %v, wantErr %t", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseReason(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReasonName(t *testing.T) {
+	tests := []struct {
+		reason int
+		want   string
+	}{
+		{reason: ocsp.Superseded, want: "superseded"},
+		{reason: ocsp.AACompromise, want: "aACompromise"},
+		{reason: 7, want: "7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := ReasonName(tt.reason); got != tt.want {
+				t.Errorf("ReasonName(%d) = %q, want %q", tt.reason, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,11 +2,447 @@ package models
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
 
+	"entgo.io/ent/dialect"
+	entsql "entgo.io/ent/dialect/sql"
 	scncore_ent "github.com/scncore/ent"
 	"github.com/scncore/ent/revocation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/ocsp"
 )
 
-func (m *Model) GetRevoked(serial int64) (*scncore_ent.Revocation, error) {
-	return m.Client.Revocation.Query().Where(revocation.ID(serial)).Only(context.Background())
+func (m *Model) GetRevoked(ctx context.Context, serial int64) (*scncore_ent.Revocation, error) {
+	err := ErrNoBackend
+	for _, b := range m.readBackends() {
+		var r *scncore_ent.Revocation
+		r, err = b.client.Revocation.Query().Where(revocation.ID(serial)).Only(ctx)
+		if err == nil || scncore_ent.IsNotFound(err) {
+			b.lookups.Add(1)
+			slog.DebugContext(ctx, "revocation lookup served", "serial", serial, "backend", b.Name, "replica", b.Replica)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("db.backend", b.Name), attribute.Bool("db.replica", b.Replica))
+			return r, err
+		}
+
+		// A deadline or a client disconnect isn't the backend's fault, so
+		// don't fail over and don't mark it as unhealthy
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		b.failures.Add(1)
+		b.healthy.Store(false)
+		slog.ErrorContext(ctx, "revocation lookup failed, failing over", "backend", b.Name, "reason", err)
+	}
+	return nil, err
+}
+
+var (
+	// ErrPermanentlyRevoked is returned when a certificate revoked with a
+	// reason other than certificateHold would be put on hold or released
+	ErrPermanentlyRevoked = errors.New("the certificate has been permanently revoked")
+	// ErrNotOnHold is returned when releasing a certificate that isn't on hold
+	ErrNotOnHold = errors.New("the certificate is not on hold")
+	// ErrNotRevoked is returned when unrevoking a certificate that is good
+	ErrNotRevoked = errors.New("the certificate has not been revoked")
+	// ErrNoHistory is returned when filtering by issuer without the
+	// revocation history, the only place the issuer is recorded
+	ErrNoHistory = errors.New("filtering by issuer needs the revocation history, run the migrate command to create it")
+)
+
+// RevocationRequest describes a change of the revocation of a certificate.
+// A zero Expiry keeps the expiry already stored. Issuer and Actor are
+// recorded in the revocation history. DryRun checks the change and rolls
+// it back
+type RevocationRequest struct {
+	Serial int64
+	Reason int
+	Info   string
+	Expiry time.Time
+	Issuer string
+	Actor  string
+	DryRun bool
+}
+
+// RevocationFilter selects revocations to list, zero values match all
+type RevocationFilter struct {
+	Reasons []int
+	From    time.Time
+	To      time.Time
+	Issuer  string
+	Limit   int
+	Offset  int
+}
+
+// GetRevocation reads a revocation from the primary database, so it sees
+// changes that haven't reached the replicas yet
+func (m *Model) GetRevocation(ctx context.Context, serial int64) (*scncore_ent.Revocation, error) {
+	return m.Client.Revocation.Get(ctx, serial)
+}
+
+// RevocationChange tells what Revoke did to a certificate
+type RevocationChange int
+
+const (
+	ChangeRevoked RevocationChange = iota
+	ChangeUpdated
+	ChangeUnchanged
+)
+
+func (c RevocationChange) String() string {
+	switch c {
+	case ChangeRevoked:
+		return "revoked"
+	case ChangeUpdated:
+		return "updated"
+	default:
+		return "unchanged"
+	}
+}
+
+// Revoke revokes a certificate or, if it's already revoked, updates its
+// reason, and its info and expiry when the request has them. Nothing is
+// written, not even to the history, when the revocation already matches
+// the request. A permanently revoked certificate can't be put on hold
+func (m *Model) Revoke(ctx context.Context, r RevocationRequest) (*scncore_ent.Revocation, RevocationChange, error) {
+	if err := ValidateReason(r.Reason); err != nil {
+		return nil, ChangeUnchanged, err
+	}
+
+	var revoked *scncore_ent.Revocation
+	change := ChangeRevoked
+	err := m.withTx(ctx, r.DryRun, func(client *scncore_ent.Client, tx *sql.Tx) error {
+		existing, err := client.Revocation.Get(ctx, r.Serial)
+		if err != nil && !scncore_ent.IsNotFound(err) {
+			return err
+		}
+
+		event := RevocationEvent{
+			Serial:    r.Serial,
+			Issuer:    r.Issuer,
+			OldStatus: StatusGood,
+			NewStatus: StatusRevoked,
+			Reason:    &r.Reason,
+			Actor:     r.Actor,
+		}
+
+		if existing == nil {
+			create := client.Revocation.Create().
+				SetID(r.Serial).
+				SetReason(r.Reason).
+				SetInfo(r.Info).
+				SetRevoked(time.Now())
+			if !r.Expiry.IsZero() {
+				create.SetExpiry(r.Expiry)
+			}
+			revoked, err = create.Save(ctx)
+		} else {
+			if r.Reason == ocsp.CertificateHold && existing.Reason != ocsp.CertificateHold {
+				return ErrPermanentlyRevoked
+			}
+			if existing.Reason == r.Reason && (r.Info == "" || existing.Info == r.Info) && (r.Expiry.IsZero() || existing.Expiry.Equal(r.Expiry)) {
+				revoked = existing
+				change = ChangeUnchanged
+				return nil
+			}
+			event.OldStatus = StatusRevoked
+			event.OldReason = &existing.Reason
+			change = ChangeUpdated
+
+			update := client.Revocation.UpdateOneID(r.Serial).
+				SetReason(r.Reason)
+			if r.Info != "" {
+				update.SetInfo(r.Info)
+			}
+			if !r.Expiry.IsZero() {
+				update.SetExpiry(r.Expiry)
+			}
+			revoked, err = update.Save(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		return m.appendEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, ChangeUnchanged, err
+	}
+	return revoked, change, nil
+}
+
+// Release removes a certificate from hold so it's good again, only Serial,
+// Issuer, Actor and DryRun are used from the request
+func (m *Model) Release(ctx context.Context, r RevocationRequest) error {
+	return m.unrevoke(ctx, r, true)
+}
+
+// Unrevoke deletes the revocation of a certificate whatever its reason,
+// it's meant to undo mistakes. Only Serial, Issuer, Actor and DryRun are
+// used from the request
+func (m *Model) Unrevoke(ctx context.Context, r RevocationRequest) error {
+	return m.unrevoke(ctx, r, false)
+}
+
+func (m *Model) unrevoke(ctx context.Context, r RevocationRequest, holdOnly bool) error {
+	return m.withTx(ctx, r.DryRun, func(client *scncore_ent.Client, tx *sql.Tx) error {
+		existing, err := client.Revocation.Get(ctx, r.Serial)
+		if scncore_ent.IsNotFound(err) {
+			if holdOnly {
+				return ErrNotOnHold
+			}
+			return ErrNotRevoked
+		}
+		if err != nil {
+			return err
+		}
+		if holdOnly && existing.Reason != ocsp.CertificateHold {
+			return ErrPermanentlyRevoked
+		}
+
+		if err := client.Revocation.DeleteOneID(r.Serial).Exec(ctx); err != nil {
+			return err
+		}
+
+		return m.appendEvent(ctx, tx, RevocationEvent{
+			Serial:    r.Serial,
+			Issuer:    r.Issuer,
+			OldStatus: StatusRevoked,
+			OldReason: &existing.Reason,
+			NewStatus: StatusGood,
+			Actor:     r.Actor,
+		})
+	})
+}
+
+// ListRevocations reads the revocations matching the filter from the
+// primary database, most recent first. The revocations table has no issuer
+// column, so the issuer filter only matches certificates whose history
+// records it, i.e. revoked or changed by the responder since its history
+// exists. Revocations written by other scncore components, or before the
+// history was created, never match
+func (m *Model) ListRevocations(ctx context.Context, f RevocationFilter) ([]*scncore_ent.Revocation, error) {
+	query := m.Client.Revocation.Query()
+	if f.Issuer != "" {
+		serials, err := m.serialsByIssuer(ctx, f.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		if len(serials) == 0 {
+			return []*scncore_ent.Revocation{}, nil
+		}
+		query.Where(revocation.IDIn(serials...))
+	}
+	if len(f.Reasons) > 0 {
+		query.Where(revocation.ReasonIn(f.Reasons...))
+	}
+	if !f.From.IsZero() {
+		query.Where(revocation.RevokedGTE(f.From))
+	}
+	if !f.To.IsZero() {
+		query.Where(revocation.RevokedLT(f.To))
+	}
+	if f.Limit > 0 {
+		query.Limit(f.Limit)
+	}
+	if f.Offset > 0 {
+		query.Offset(f.Offset)
+	}
+	return query.Order(revocation.ByRevoked(entsql.OrderDesc()), revocation.ByID()).All(ctx)
+}
+
+// serialsByIssuer returns the serials whose history records the issuer,
+// revocations made by other scncore components have no issuer recorded
+func (m *Model) serialsByIssuer(ctx context.Context, issuer string) ([]int64, error) {
+	if m.DisableHistory || m.checkColumns(ctx, historyColumns) != nil {
+		return nil, ErrNoHistory
+	}
+
+	rows, err := m.backends[0].db.QueryContext(ctx, "SELECT DISTINCT serial FROM ocsp_revocation_events WHERE issuer = $1", issuer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	serials := []int64{}
+	for rows.Next() {
+		var serial int64
+		if err := rows.Scan(&serial); err != nil {
+			return nil, err
+		}
+		serials = append(serials, serial)
+	}
+	return serials, rows.Err()
+}
+
+// ImportResult counts the revocations created, updated and left unchanged
+// by an import, and lists the conflicts left as they were
+type ImportResult struct {
+	Created   int
+	Updated   int
+	Unchanged int
+	Conflicts []ImportConflict
+}
+
+// ImportConflict is a stored revocation that differs from the imported one.
+// Permanent is set when the import would put a permanently revoked
+// certificate on hold, which is never done even without KeepExisting
+type ImportConflict struct {
+	Existing  *scncore_ent.Revocation
+	Imported  *scncore_ent.Revocation
+	Permanent bool
+}
+
+// ImportOptions tune an import. Issuer and Actor are recorded in the
+// history. KeepExisting reports stored revocations that differ as
+// conflicts instead of updating them. StatusOnly compares and updates only
+// the reason and the revocation time, keeping the stored info and expiry
+type ImportOptions struct {
+	Issuer       string
+	Actor        string
+	DryRun       bool
+	KeepExisting bool
+	StatusOnly   bool
+}
+
+// ImportRevocations restores revocations as they are, revocation times
+// included, in a single transaction. Importing the same revocations again
+// changes nothing, revocations missing from the import are kept. Like
+// Revoke, it never puts a permanently revoked certificate on hold
+func (m *Model) ImportRevocations(ctx context.Context, revocations []*scncore_ent.Revocation, o ImportOptions) (ImportResult, error) {
+	result := ImportResult{}
+	for _, r := range revocations {
+		if err := ValidateReason(r.Reason); err != nil {
+			return result, fmt.Errorf("revocation %d: %w", r.ID, err)
+		}
+	}
+
+	err := m.withTx(ctx, o.DryRun, func(client *scncore_ent.Client, tx *sql.Tx) error {
+		for _, r := range revocations {
+			existing, err := client.Revocation.Get(ctx, r.ID)
+			if err != nil && !scncore_ent.IsNotFound(err) {
+				return err
+			}
+
+			event := RevocationEvent{
+				Serial:    r.ID,
+				Issuer:    o.Issuer,
+				OldStatus: StatusGood,
+				NewStatus: StatusRevoked,
+				Reason:    &r.Reason,
+				Actor:     o.Actor,
+			}
+
+			switch importDecision(existing, r, o) {
+			case importUnchanged:
+				result.Unchanged++
+				continue
+			case importPermanentConflict:
+				result.Conflicts = append(result.Conflicts, ImportConflict{Existing: existing, Imported: r, Permanent: true})
+				continue
+			case importConflict:
+				result.Conflicts = append(result.Conflicts, ImportConflict{Existing: existing, Imported: r})
+				continue
+			case importCreate:
+				create := client.Revocation.Create().
+					SetID(r.ID).
+					SetReason(r.Reason).
+					SetInfo(r.Info).
+					SetRevoked(r.Revoked)
+				if !r.Expiry.IsZero() {
+					create.SetExpiry(r.Expiry)
+				}
+				err = create.Exec(ctx)
+				result.Created++
+			case importUpdate:
+				event.OldStatus = StatusRevoked
+				event.OldReason = &existing.Reason
+				update := client.Revocation.UpdateOneID(r.ID).
+					SetReason(r.Reason).
+					SetRevoked(r.Revoked)
+				if !o.StatusOnly {
+					update.SetInfo(r.Info)
+					if !r.Expiry.IsZero() {
+						update.SetExpiry(r.Expiry)
+					}
+				}
+				err = update.Exec(ctx)
+				result.Updated++
+			}
+			if err != nil {
+				return fmt.Errorf("revocation %d: %w", r.ID, err)
+			}
+
+			if err := m.appendEvent(ctx, tx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return result, nil
+}
+
+// importAction is what an import does with a revocation
+type importAction int
+
+const (
+	importCreate importAction = iota
+	importUpdate
+	importUnchanged
+	importConflict
+	importPermanentConflict
+)
+
+// importDecision compares an imported revocation with the stored one,
+// existing is nil when the certificate isn't revoked
+func importDecision(existing, imported *scncore_ent.Revocation, o ImportOptions) importAction {
+	if existing == nil {
+		return importCreate
+	}
+
+	same := existing.Reason == imported.Reason && existing.Revoked.Equal(imported.Revoked)
+	if !o.StatusOnly {
+		// a zero expiry keeps the stored one, as Revoke does
+		same = same && existing.Info == imported.Info && (imported.Expiry.IsZero() || existing.Expiry.Equal(imported.Expiry))
+	}
+	switch {
+	case same:
+		return importUnchanged
+	case imported.Reason == ocsp.CertificateHold && existing.Reason != ocsp.CertificateHold:
+		return importPermanentConflict
+	case o.KeepExisting:
+		return importConflict
+	}
+	return importUpdate
+}
+
+// withTx runs fn in a transaction on the primary database, fn gets an ent
+// client bound to the transaction and the transaction itself for the
+// tables that aren't part of the ent schema. With dryRun the transaction is
+// rolled back once fn succeeds
+func (m *Model) withTx(ctx context.Context, dryRun bool, fn func(client *scncore_ent.Client, tx *sql.Tx) error) error {
+	tx, err := m.backends[0].db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	client := scncore_ent.NewClient(scncore_ent.Driver(entsql.NewDriver(dialect.Postgres, entsql.Conn{ExecQuerier: tx})))
+	if err := fn(client, tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return fmt.Errorf("%w: could not rollback transaction: %v", err, rerr)
+		}
+		return err
+	}
+	if dryRun {
+		return tx.Rollback()
+	}
+	return tx.Commit()
 }
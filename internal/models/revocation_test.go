@@ -0,0 +1,102 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	scncore_ent "github.com/scncore/ent"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestImportDecision(t *testing.T) {
+	revoked := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	expiry := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	stored := func(reason int) *scncore_ent.Revocation {
+		return &scncore_ent.Revocation{ID: 10, Reason: reason, Info: "stored", Revoked: revoked, Expiry: expiry}
+	}
+
+	tests := []struct {
+		name     string
+		existing *scncore_ent.Revocation
+		imported *scncore_ent.Revocation
+		options  ImportOptions
+		want     importAction
+	}{
+		{
+			name:     "not revoked",
+			imported: stored(ocsp.KeyCompromise),
+			want:     importCreate,
+		},
+		{
+			name:     "same revocation",
+			existing: stored(ocsp.KeyCompromise),
+			imported: stored(ocsp.KeyCompromise),
+			want:     importUnchanged,
+		},
+		{
+			name:     "zero expiry keeps the stored one",
+			existing: stored(ocsp.KeyCompromise),
+			imported: &scncore_ent.Revocation{ID: 10, Reason: ocsp.KeyCompromise, Info: "stored", Revoked: revoked},
+			want:     importUnchanged,
+		},
+		{
+			name:     "other reason",
+			existing: stored(ocsp.KeyCompromise),
+			imported: stored(ocsp.Superseded),
+			want:     importUpdate,
+		},
+		{
+			name:     "other revocation time",
+			existing: stored(ocsp.KeyCompromise),
+			imported: &scncore_ent.Revocation{ID: 10, Reason: ocsp.KeyCompromise, Info: "stored", Revoked: revoked.Add(time.Hour), Expiry: expiry},
+			want:     importUpdate,
+		},
+		{
+			name:     "other info",
+			existing: stored(ocsp.KeyCompromise),
+			imported: &scncore_ent.Revocation{ID: 10, Reason: ocsp.KeyCompromise, Info: "imported", Revoked: revoked, Expiry: expiry},
+			want:     importUpdate,
+		},
+		{
+			name:     "other info with status only",
+			existing: stored(ocsp.KeyCompromise),
+			imported: &scncore_ent.Revocation{ID: 10, Reason: ocsp.KeyCompromise, Info: "imported", Revoked: revoked},
+			options:  ImportOptions{StatusOnly: true},
+			want:     importUnchanged,
+		},
+		{
+			name:     "keep existing",
+			existing: stored(ocsp.KeyCompromise),
+			imported: stored(ocsp.Superseded),
+			options:  ImportOptions{KeepExisting: true},
+			want:     importConflict,
+		},
+		{
+			name:     "hold over a permanent revocation",
+			existing: stored(ocsp.KeyCompromise),
+			imported: stored(ocsp.CertificateHold),
+			want:     importPermanentConflict,
+		},
+		{
+			name:     "hold over a permanent revocation keeping existing",
+			existing: stored(ocsp.KeyCompromise),
+			imported: stored(ocsp.CertificateHold),
+			options:  ImportOptions{KeepExisting: true},
+			want:     importPermanentConflict,
+		},
+		{
+			name:     "permanent revocation of a certificate on hold",
+			existing: stored(ocsp.CertificateHold),
+			imported: stored(ocsp.KeyCompromise),
+			want:     importUpdate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := importDecision(tt.existing, tt.imported, tt.options); got != tt.want {
+				t.Errorf("importDecision() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
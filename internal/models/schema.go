@@ -0,0 +1,229 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ErrIncompatibleSchema is returned when the database schema lacks the
+// tables or columns the responder reads
+var ErrIncompatibleSchema = errors.New("the database schema is not compatible with this responder, run the migrate command")
+
+// ErrNewerSchema is returned when the responder tables have been migrated
+// by a newer responder
+var ErrNewerSchema = errors.New("the responder tables have been migrated by a newer responder")
+
+// SchemaVersion is the version of the tables owned by the responder, bump
+// it whenever responderSchema changes
+const SchemaVersion = 1
+
+// requiredColumns lists the columns the responder reads, by table
+var requiredColumns = map[string][]string{
+	"revocations": {"id", "reason", "info", "expiry", "revoked"},
+}
+
+// historyColumns are the columns of the revocation history, which is only
+// needed to record and query revocation changes
+var historyColumns = map[string][]string{
+	"ocsp_revocation_events": {"id", "serial", "issuer", "old_status", "old_reason", "new_status", "reason", "actor", "created_at"},
+}
+
+// auditColumns are the columns of the audit table, which is only needed
+// when signed responses are audited to the database
+var auditColumns = map[string][]string{
+	"ocsp_response_audit": {"id", "created_at", "serial", "issuer", "status", "reason", "this_update", "next_update", "client_ip", "response_sha256", "request_id"},
+}
+
+// SchemaOptions selects the optional tables CheckSchema verifies
+type SchemaOptions struct {
+	History bool
+	Audit   bool
+}
+
+// responderSchema holds the tables owned by the responder, they're not part
+// of the ent schema shared with the rest of scncore. Statements must be
+// idempotent as they're run on every migration
+var responderSchema = []string{
+	`CREATE TABLE IF NOT EXISTS ocsp_schema_version (
+	version INTEGER NOT NULL
+)`,
+	`CREATE TABLE IF NOT EXISTS ocsp_revocation_events (
+	id BIGSERIAL PRIMARY KEY,
+	serial BIGINT NOT NULL,
+	issuer TEXT NOT NULL,
+	old_status TEXT NOT NULL,
+	old_reason INTEGER,
+	new_status TEXT NOT NULL,
+	reason INTEGER,
+	actor TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`,
+	`CREATE INDEX IF NOT EXISTS ocsp_revocation_events_serial_created_at ON ocsp_revocation_events (serial, created_at)`,
+	`CREATE OR REPLACE FUNCTION ocsp_revocation_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'ocsp_revocation_events is append-only';
+END;
+$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS ocsp_revocation_events_append_only ON ocsp_revocation_events`,
+	`CREATE TRIGGER ocsp_revocation_events_append_only BEFORE UPDATE OR DELETE ON ocsp_revocation_events
+	FOR EACH ROW EXECUTE FUNCTION ocsp_revocation_events_append_only()`,
+	`CREATE TABLE IF NOT EXISTS ocsp_response_audit (
+	id BIGSERIAL PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	serial TEXT NOT NULL,
+	issuer TEXT NOT NULL,
+	status TEXT NOT NULL,
+	reason INTEGER,
+	this_update TIMESTAMPTZ NOT NULL,
+	next_update TIMESTAMPTZ NOT NULL,
+	client_ip TEXT NOT NULL,
+	response_sha256 TEXT NOT NULL,
+	request_id TEXT NOT NULL
+)`,
+	`CREATE INDEX IF NOT EXISTS ocsp_response_audit_serial_created_at ON ocsp_response_audit (serial, created_at)`,
+	`CREATE INDEX IF NOT EXISTS ocsp_response_audit_created_at ON ocsp_response_audit (created_at)`,
+	`CREATE OR REPLACE FUNCTION ocsp_response_audit_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'ocsp_response_audit is append-only';
+END;
+$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS ocsp_response_audit_append_only ON ocsp_response_audit`,
+	`CREATE TRIGGER ocsp_response_audit_append_only BEFORE UPDATE OR DELETE ON ocsp_response_audit
+	FOR EACH ROW EXECUTE FUNCTION ocsp_response_audit_append_only()`,
+}
+
+// CheckSchema verifies that the schema contains everything the responder
+// needs, and the optional tables selected by o, without modifying it. The
+// responder tables must not have been migrated by a newer responder, and
+// must be up to date when o selects any of them
+func (m *Model) CheckSchema(ctx context.Context, o SchemaOptions) error {
+	if err := m.checkColumns(ctx, requiredColumns); err != nil {
+		return err
+	}
+
+	version, err := m.schemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("%w to version %d, this one supports version %d", ErrNewerSchema, version, SchemaVersion)
+	}
+	if (o.Audit || o.History) && version < SchemaVersion {
+		return fmt.Errorf("%w: the responder tables are at version %d, version %d is needed", ErrIncompatibleSchema, version, SchemaVersion)
+	}
+
+	if o.Audit {
+		if err := m.checkColumns(ctx, auditColumns); err != nil {
+			return err
+		}
+	}
+	if o.History {
+		return m.checkColumns(ctx, historyColumns)
+	}
+	return nil
+}
+
+// schemaVersion returns the version recorded by the last migration, 0 if
+// the responder tables have never been migrated
+func (m *Model) schemaVersion(ctx context.Context) (int, error) {
+	b := m.readBackends()[0]
+
+	var exists bool
+	if err := b.db.QueryRowContext(ctx, "SELECT to_regclass('ocsp_schema_version') IS NOT NULL").Scan(&exists); err != nil {
+		return 0, fmt.Errorf("could not read the schema version: %v", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	err := b.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM ocsp_schema_version").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("could not read the schema version: %v", err)
+	}
+	return version, nil
+}
+
+func (m *Model) checkColumns(ctx context.Context, tables map[string][]string) error {
+	b := m.readBackends()[0]
+
+	for table, columns := range tables {
+		rows, err := b.db.QueryContext(ctx, "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1", table)
+		if err != nil {
+			return fmt.Errorf("could not read the schema of table %s: %v", table, err)
+		}
+
+		found := []string{}
+		for rows.Next() {
+			var column string
+			if err := rows.Scan(&column); err != nil {
+				rows.Close()
+				return err
+			}
+			found = append(found, column)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		missing := []string{}
+		for _, column := range columns {
+			if !slices.Contains(found, column) {
+				missing = append(missing, column)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("%w: table %s misses columns %s", ErrIncompatibleSchema, table, strings.Join(missing, ", "))
+		}
+	}
+
+	return nil
+}
+
+// Migrate applies the responder tables to the primary database and records
+// their version. The revocations table belongs to the schema shared with
+// the rest of scncore, which is migrated by the scncore server and only
+// checked here. With dryRun the planned statements are written to out and
+// nothing is changed
+func (m *Model) Migrate(ctx context.Context, dryRun bool, out io.Writer) error {
+	if err := m.checkColumns(ctx, requiredColumns); err != nil {
+		return fmt.Errorf("%v, the revocations table is created by the scncore server", err)
+	}
+	version, err := m.schemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("%w to version %d, this one supports version %d", ErrNewerSchema, version, SchemaVersion)
+	}
+
+	statements := append(slices.Clone(responderSchema),
+		"DELETE FROM ocsp_schema_version",
+		fmt.Sprintf("INSERT INTO ocsp_schema_version (version) VALUES (%d)", SchemaVersion))
+
+	if dryRun {
+		for _, statement := range statements {
+			if _, err := fmt.Fprintf(out, "%s;\n", statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tx, err := m.backends[0].db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
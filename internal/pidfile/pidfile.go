@@ -0,0 +1,90 @@
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ErrRunning is returned when the PID file names a process that is still
+// running
+var ErrRunning = errors.New("the OCSP responder is already running")
+
+// Write creates the PID file of the current process, and its directory if
+// needed. A file left by a process that is no longer running is replaced
+func Write(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("could not create the directory of the PID file: %v", err)
+	}
+
+	for range 2 {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = f.WriteString(strconv.Itoa(os.Getpid()))
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+
+		pid, err := Read(path)
+		if err == nil && Running(pid) {
+			return fmt.Errorf("%w with pid %d, see %s", ErrRunning, pid, path)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not remove the stale PID file %s: %v", path, err)
+		}
+	}
+	return fmt.Errorf("could not create the PID file %s", path)
+}
+
+// Read returns the PID stored in the file
+func Read(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("%s does not contain a valid pid", path)
+	}
+	return pid, nil
+}
+
+// Remove deletes the PID file if it still holds pid, so the file of a
+// responder started in the meantime is kept
+func Remove(path string, pid int) error {
+	current, err := Read(path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && current != pid) {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// sameExecutable reports whether path is the executable of this process,
+// it's assumed to be if the executable of this process is unknown
+func sameExecutable(path string) bool {
+	self, err := os.Executable()
+	if err != nil {
+		return true
+	}
+	if resolved, err := filepath.EvalSymlinks(self); err == nil {
+		self = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Clean(self), filepath.Clean(path))
+	}
+	return filepath.Clean(self) == filepath.Clean(path)
+}
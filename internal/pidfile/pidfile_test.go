@@ -0,0 +1,145 @@
+package pidfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// deadPID is larger than any pid the system hands out
+const deadPID = 999999999
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		wantErr bool
+	}{
+		{name: "pid", content: "1234", want: 1234},
+		{name: "trailing newline", content: "1234\n", want: 1234},
+		{name: "zero", content: "0", wantErr: true},
+		{name: "negative", content: "-5", wantErr: true},
+		{name: "garbage", content: "responder", wantErr: true},
+		{name: "empty", content: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "PIDFILE")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Read(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Read() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Read(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Read() of a missing file error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		wantErr  error
+	}{
+		{name: "no file"},
+		{name: "stale pid", existing: strconv.Itoa(deadPID)},
+		{name: "invalid content", existing: "garbage"},
+		{name: "running responder", existing: strconv.Itoa(os.Getpid()), wantErr: ErrRunning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "run", "PIDFILE")
+			if tt.existing != "" {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := Write(path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Write() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if pid, err := Read(path); err != nil || pid != os.Getpid() {
+				t.Errorf("the PID file holds %d, %v, want %d", pid, err, os.Getpid())
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		wantKept bool
+	}{
+		{name: "own pid", existing: "100"},
+		{name: "pid of another responder", existing: "200", wantKept: true},
+		{name: "invalid content", existing: "garbage"},
+		{name: "no file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "PIDFILE")
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := Remove(path, 100); err != nil {
+				t.Fatalf("Remove() error = %v", err)
+			}
+			_, err := os.Stat(path)
+			if kept := err == nil; kept != tt.wantKept {
+				t.Errorf("PID file kept = %t, want %t", kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestSameExecutable(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Skip("the executable of the test is unknown")
+	}
+	other := filepath.Join(t.TempDir(), "other")
+	if err := os.WriteFile(other, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if !sameExecutable(self) {
+		t.Errorf("sameExecutable(%s) = false for the test executable", self)
+	}
+	if sameExecutable(other) {
+		t.Errorf("sameExecutable(%s) = true for another file", other)
+	}
+
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(self, link); err != nil {
+		t.Logf("could not create a symlink: %v", err)
+		return
+	}
+	if !sameExecutable(link) {
+		t.Errorf("sameExecutable(%s) = false for a symlink to the test executable", link)
+	}
+}
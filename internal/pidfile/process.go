@@ -0,0 +1,48 @@
+//go:build !windows
+
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// DefaultPath is the PID file used unless another one is configured, the
+// runtime directory is only writable by root
+const DefaultPath = "/run/scncore-ocsp-responder/PIDFILE"
+
+// Running reports whether pid is a running process of this executable, a
+// process that reused the pid of a responder that is gone is not
+func Running(pid int) bool {
+	if err := syscall.Kill(pid, 0); err != nil {
+		// EPERM means the process exists but belongs to another user
+		return errors.Is(err, syscall.EPERM)
+	}
+
+	// without procfs the process can't be told apart from the responder
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return true
+	}
+	// the executable may have been replaced while the responder runs
+	return sameExecutable(strings.TrimSuffix(exe, " (deleted)"))
+}
+
+// Terminate asks the process to shut down gracefully
+func Terminate(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
+
+// StopRequested returns a channel closed when Terminate is called from
+// another process. SIGTERM already asks this one to stop, so it's nil
+func StopRequested() (<-chan struct{}, error) {
+	return nil, nil
+}
+
+// Kill stops the process immediately
+func Kill(pid int) error {
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
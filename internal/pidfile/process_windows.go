@@ -0,0 +1,105 @@
+//go:build windows
+
+package pidfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// stillActive is the exit code of a process that hasn't exited
+const stillActive = 259
+
+// DefaultPath is the PID file used unless another one is configured
+var DefaultPath = filepath.Join(programData(), "scncore-ocsp-responder", "PIDFILE")
+
+func programData() string {
+	if dir := os.Getenv("ProgramData"); dir != "" {
+		return dir
+	}
+	return os.TempDir()
+}
+
+// Running reports whether pid is a running process of this executable, a
+// process that reused the pid of a responder that is gone is not
+func Running(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// the process exists if we're only denied access to it
+		return err == windows.ERROR_ACCESS_DENIED
+	}
+	defer windows.CloseHandle(h)
+
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	if code != stillActive {
+		return false
+	}
+
+	// if the image can't be read the process can't be told apart from the
+	// responder
+	name := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(name))
+	if err := windows.QueryFullProcessImageName(h, 0, &name[0], &size); err != nil {
+		return true
+	}
+	return sameExecutable(windows.UTF16ToString(name[:size]))
+}
+
+// stopEvent names the event a responder waits on for stop requests, it's
+// local to the session so stop must run in the session of start
+func stopEvent(pid int) (*uint16, error) {
+	return windows.UTF16PtrFromString(fmt.Sprintf("scncore-ocsp-responder-stop-%d", pid))
+}
+
+// Terminate asks the process to shut down gracefully by signalling its stop
+// event, as Windows can't deliver an interrupt to another console process.
+// A process without the event is killed
+func Terminate(pid int) error {
+	name, err := stopEvent(pid)
+	if err != nil {
+		return err
+	}
+	h, err := windows.OpenEvent(windows.EVENT_MODIFY_STATE, false, name)
+	if err != nil {
+		return Kill(pid)
+	}
+	defer windows.CloseHandle(h)
+	return windows.SetEvent(h)
+}
+
+// StopRequested returns a channel closed when Terminate is called from
+// another process
+func StopRequested() (<-chan struct{}, error) {
+	name, err := stopEvent(os.Getpid())
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.CreateEvent(nil, 1, 0, name)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the stop event: %v", err)
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		defer windows.CloseHandle(h)
+		if event, err := windows.WaitForSingleObject(h, windows.INFINITE); err == nil && event == windows.WAIT_OBJECT_0 {
+			close(stop)
+		}
+	}()
+	return stop, nil
+}
+
+// Kill stops the process immediately
+func Kill(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
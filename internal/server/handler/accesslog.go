@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/scncore/scncore-ocsp-responder/internal/logging"
+)
+
+// keys used by Verify to hand the request details to the access log
+const (
+	issuerKey = "ocsp_issuer"
+	serialKey = "ocsp_serial"
+	statusKey = "ocsp_status"
+	actorKey  = "admin_actor"
+)
+
+// RequestID reuses the X-Request-ID header sent by the client or generates
+// one, and stores it in the request context so every log record carries it
+func RequestID() echo.MiddlewareFunc {
+	return middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, id string) {
+			c.SetRequest(c.Request().WithContext(logging.WithRequestID(c.Request().Context(), id)))
+		},
+	})
+}
+
+// AccessLog logs a line per request once it has been answered
+func AccessLog(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		if err != nil {
+			c.Error(err)
+		}
+
+		attrs := []any{
+			slog.String("method", c.Request().Method),
+			slog.String("path", c.Path()),
+			slog.String("client_ip", c.RealIP()),
+			slog.Int("http_status", c.Response().Status),
+			slog.Duration("latency", time.Since(start)),
+		}
+		for _, field := range [][2]string{{issuerKey, "issuer"}, {serialKey, "serial"}, {statusKey, "status"}, {actorKey, "actor"}} {
+			if value := c.Get(field[0]); value != nil {
+				attrs = append(attrs, slog.Any(field[1], value))
+			}
+		}
+		slog.InfoContext(c.Request().Context(), "access", attrs...)
+		return nil
+	}
+}
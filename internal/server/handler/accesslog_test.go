@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/scncore/scncore-ocsp-responder/internal/logging"
+)
+
+func TestRequestIDAndAccessLog(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := logging.New(&out, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	var seen string
+	e := echo.New()
+	e.Use(RequestID(), AccessLog)
+	e.GET("/ocsp", func(c echo.Context) error {
+		seen = logging.RequestID(c.Request().Context())
+		c.Set(serialKey, "01")
+		return c.NoContent(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "reuses the client's ID", header: "client-id-42"},
+		{name: "generates an ID", header: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+			seen = ""
+			req := httptest.NewRequest(http.MethodGet, "/ocsp", nil)
+			if tt.header != "" {
+				req.Header.Set(echo.HeaderXRequestID, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(echo.HeaderXRequestID)
+			if id == "" {
+				t.Fatal("the response has no X-Request-ID header")
+			}
+			if tt.header != "" && id != tt.header {
+				t.Errorf("X-Request-ID = %q, want the client's %q", id, tt.header)
+			}
+			if seen != id {
+				t.Errorf("the request context carries the ID %q, want %q", seen, id)
+			}
+
+			var line struct {
+				Msg        string `json:"msg"`
+				RequestID  string `json:"request_id"`
+				HTTPStatus int    `json:"http_status"`
+				Path       string `json:"path"`
+				Serial     string `json:"serial"`
+			}
+			if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+				t.Fatalf("could not read the access log %q: %v", out.String(), err)
+			}
+			if line.Msg != "access" || line.RequestID != id || line.HTTPStatus != http.StatusOK || line.Path != "/ocsp" || line.Serial != "01" {
+				t.Errorf("access log = %+v, want request %s answered 200 for serial 01", line, id)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/scncore/ent"
+	"github.com/scncore/scncore-ocsp-responder/internal/models"
+	"golang.org/x/crypto/ocsp"
+)
+
+// AdminAuth lists the credentials accepted by the admin API: bearer tokens
+// and, if ClientCert is set, client certificates. These are verified
+// against ClientCAs, or by the TLS listener against its client CA bundle
+// when ClientCAs is nil, and must carry one of ClientNames as common name
+// or subject alternative name when the list isn't empty
+type AdminAuth struct {
+	Tokens      []string
+	ClientCert  bool
+	ClientCAs   *x509.CertPool
+	ClientNames []string
+}
+
+// Enabled reports whether any credential has been configured, the admin
+// API isn't served otherwise
+func (a AdminAuth) Enabled() bool {
+	return len(a.Tokens) > 0 || a.ClientCert
+}
+
+// clientCertificate returns the admin client certificate of the connection
+func (a AdminAuth) clientCertificate(state *tls.ConnectionState) (*x509.Certificate, bool) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil, false
+	}
+	cert := state.PeerCertificates[0]
+
+	if a.ClientCAs != nil {
+		intermediates := x509.NewCertPool()
+		for _, c := range state.PeerCertificates[1:] {
+			intermediates.AddCert(c)
+		}
+		opts := x509.VerifyOptions{Roots: a.ClientCAs, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+		if _, err := cert.Verify(opts); err != nil {
+			return nil, false
+		}
+	} else if len(state.VerifiedChains) == 0 {
+		return nil, false
+	}
+
+	if len(a.ClientNames) > 0 && !slices.ContainsFunc(certificateNames(cert), func(name string) bool {
+		return slices.Contains(a.ClientNames, name)
+	}) {
+		return nil, false
+	}
+	return cert, true
+}
+
+// certificateNames returns the common name and the subject alternative
+// names of cert
+func certificateNames(cert *x509.Certificate) []string {
+	names := []string{cert.Subject.CommonName}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
+// RevocationView is the JSON representation of a revocation
+type RevocationView struct {
+	Serial     string    `json:"serial"`
+	Reason     int       `json:"reason"`
+	ReasonName string    `json:"reason_name"`
+	Info       string    `json:"info,omitempty"`
+	Expiry     time.Time `json:"expiry,omitzero"`
+	Revoked    time.Time `json:"revoked,omitzero"`
+}
+
+type revokeRequest struct {
+	Serial string    `json:"serial"`
+	Reason string    `json:"reason"`
+	Info   string    `json:"info"`
+	Expiry time.Time `json:"expiry"`
+}
+
+// RegisterAdmin adds the admin routes to g
+func (h *Handler) RegisterAdmin(g *echo.Group) {
+	g.Use(h.adminAuth)
+
+	g.GET("/revocations", h.ListRevocations)
+	g.GET("/revocations/:serial", h.GetRevocation)
+	g.POST("/revocations", h.Revoke)
+	g.POST("/revocations/:serial/hold", h.Hold)
+	g.POST("/revocations/:serial/release", h.Release)
+	g.GET("/revocations/:serial/history", h.History)
+	g.GET("/revocations/:serial/status", h.StatusAt)
+}
+
+func (h *Handler) adminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if actor, ok := h.authenticate(c); ok {
+			c.Set(actorKey, actor)
+			return next(c)
+		}
+		return echo.NewHTTPError(http.StatusUnauthorized, "valid bearer token or client certificate required")
+	}
+}
+
+// authenticate returns who is calling the admin API
+func (h *Handler) authenticate(c echo.Context) (string, bool) {
+	if h.AdminAuth.ClientCert {
+		if cert, ok := h.AdminAuth.clientCertificate(c.Request().TLS); ok {
+			return "cert:" + cert.Subject.CommonName, true
+		}
+	}
+
+	token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	for _, t := range h.AdminAuth.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			// identify the token without logging it
+			return fmt.Sprintf("token:%X", sha256.Sum256([]byte(t)))[:14], true
+		}
+	}
+	return "", false
+}
+
+func (h *Handler) ListRevocations(c echo.Context) error {
+	model, err := h.adminModel()
+	if err != nil {
+		return err
+	}
+
+	filter := models.RevocationFilter{Issuer: c.QueryParam("issuer")}
+	if reason := c.QueryParam("reason"); reason != "" {
+		code, err := models.ParseReason(reason)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		filter.Reasons = []int{code}
+	}
+	for param, value := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		if v := c.QueryParam(param); v != "" {
+			if *value, err = strconv.Atoi(v); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a number", param))
+			}
+		}
+	}
+
+	revocations, err := model.ListRevocations(c.Request().Context(), filter)
+	if err != nil {
+		return adminError(err)
+	}
+
+	views := []RevocationView{}
+	for _, r := range revocations {
+		views = append(views, NewRevocationView(r))
+	}
+	return c.JSON(http.StatusOK, views)
+}
+
+func (h *Handler) GetRevocation(c echo.Context) error {
+	model, err := h.adminModel()
+	if err != nil {
+		return err
+	}
+	serial, err := serialParam(c.Param("serial"))
+	if err != nil {
+		return err
+	}
+
+	r, err := model.GetRevocation(c.Request().Context(), serial.Int64())
+	if err != nil {
+		return adminError(err)
+	}
+	return c.JSON(http.StatusOK, NewRevocationView(r))
+}
+
+func (h *Handler) Revoke(c echo.Context) error {
+	var body revokeRequest
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+	if body.Reason == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "reason is required")
+	}
+	reason, err := models.ParseReason(body.Reason)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return h.revoke(c, body.Serial, reason, body)
+}
+
+func (h *Handler) Hold(c echo.Context) error {
+	var body revokeRequest
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+	return h.revoke(c, c.Param("serial"), ocsp.CertificateHold, body)
+}
+
+func (h *Handler) revoke(c echo.Context, value string, reason int, body revokeRequest) error {
+	model, err := h.adminModel()
+	if err != nil {
+		return err
+	}
+	serial, err := serialParam(value)
+	if err != nil {
+		return err
+	}
+
+	r, change, err := model.Revoke(c.Request().Context(), models.RevocationRequest{
+		Serial: serial.Int64(),
+		Reason: reason,
+		Info:   body.Info,
+		Expiry: body.Expiry,
+		Issuer: h.issuer(),
+		Actor:  c.Get(actorKey).(string),
+	})
+	if err != nil {
+		return adminError(err)
+	}
+	if change != models.ChangeUnchanged {
+		slog.InfoContext(c.Request().Context(), "certificate has been "+change.String(), "serial", serial, "reason", models.ReasonName(reason), "actor", c.Get(actorKey))
+	}
+	return c.JSON(http.StatusOK, NewRevocationView(r))
+}
+
+func (h *Handler) Release(c echo.Context) error {
+	model, err := h.adminModel()
+	if err != nil {
+		return err
+	}
+	serial, err := serialParam(c.Param("serial"))
+	if err != nil {
+		return err
+	}
+
+	release := models.RevocationRequest{Serial: serial.Int64(), Issuer: h.issuer(), Actor: c.Get(actorKey).(string)}
+	if err := model.Release(c.Request().Context(), release); err != nil {
+		return adminError(err)
+	}
+	slog.InfoContext(c.Request().Context(), "certificate has been released from hold", "serial", serial, "actor", c.Get(actorKey))
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) History(c echo.Context) error {
+	model, err := h.adminModel()
+	if err != nil {
+		return err
+	}
+	serial, err := serialParam(c.Param("serial"))
+	if err != nil {
+		return err
+	}
+
+	events, err := model.GetHistory(c.Request().Context(), serial.Int64())
+	if err != nil {
+		return adminError(err)
+	}
+	return c.JSON(http.StatusOK, events)
+}
+
+// StatusAt answers the status the responder would have returned at the
+// time given by the at query parameter in RFC 3339 format, now by default
+func (h *Handler) StatusAt(c echo.Context) error {
+	model, err := h.adminModel()
+	if err != nil {
+		return err
+	}
+	serial, err := serialParam(c.Param("serial"))
+	if err != nil {
+		return err
+	}
+
+	at := time.Now()
+	if value := c.QueryParam("at"); value != "" {
+		if at, err = time.Parse(time.RFC3339, value); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "at must be a RFC 3339 time")
+		}
+	}
+
+	status, err := model.GetStatusAt(c.Request().Context(), serial.Int64(), at)
+	if err != nil {
+		return adminError(err)
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// issuer identifies the CA in the revocation history
+func (h *Handler) issuer() string {
+	if h.CACert == nil {
+		return ""
+	}
+	return h.CACert.Subject.String()
+}
+
+func (h *Handler) adminModel() (*models.Model, error) {
+	model := h.Model()
+	if model == nil {
+		return nil, echo.NewHTTPError(http.StatusServiceUnavailable, "the responder is connecting with the database")
+	}
+	return model, nil
+}
+
+// ParseSerial accepts a decimal serial number or a hexadecimal one
+// prefixed with 0x. Serials are stored as 64-bit integers
+func ParseSerial(value string) (*big.Int, error) {
+	serial, ok := new(big.Int).SetString(value, 0)
+	if !ok || serial.Sign() < 0 || !serial.IsInt64() {
+		return nil, fmt.Errorf("%s is not a valid serial number", value)
+	}
+	return serial, nil
+}
+
+func serialParam(value string) (*big.Int, error) {
+	serial, err := ParseSerial(value)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return serial, nil
+}
+
+func adminError(err error) error {
+	switch {
+	case ent.IsNotFound(err):
+		return echo.NewHTTPError(http.StatusNotFound, "the certificate has not been revoked")
+	case errors.Is(err, models.ErrPermanentlyRevoked), errors.Is(err, models.ErrNotOnHold):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, models.ErrNoHistory):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func NewRevocationView(r *ent.Revocation) RevocationView {
+	return RevocationView{
+		Serial:     strconv.FormatInt(r.ID, 10),
+		Reason:     r.Reason,
+		ReasonName: models.ReasonName(r.Reason),
+		Info:       r.Info,
+		Expiry:     r.Expiry,
+		Revoked:    r.Revoked,
+	}
+}
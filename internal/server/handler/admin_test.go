@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// testIssuer signs the certificates of the admin authentication tests
+type testIssuer struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestIssuer(t *testing.T, name string) testIssuer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testIssuer{cert: cert, key: key}
+}
+
+// issue returns a certificate for name with the extended key usages
+func (i testIssuer) issue(t *testing.T, name string, usages ...x509.ExtKeyUsage) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name + ".example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  usages,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, i.cert, key.Public(), i.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestAuthenticate(t *testing.T) {
+	adminCA := newTestIssuer(t, "admin CA")
+	otherCA := newTestIssuer(t, "other CA")
+	adminCAs := x509.NewCertPool()
+	adminCAs.AddCert(adminCA.cert)
+
+	admin := adminCA.issue(t, "admin", x509.ExtKeyUsageClientAuth)
+	serverOnly := adminCA.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	stranger := otherCA.issue(t, "stranger", x509.ExtKeyUsageClientAuth)
+
+	peer := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	}
+	verified := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	tests := []struct {
+		name      string
+		auth      AdminAuth
+		token     string
+		tls       *tls.ConnectionState
+		wantActor string
+		wantOK    bool
+	}{
+		{name: "valid token", auth: AdminAuth{Tokens: []string{"one", "two"}}, token: "two", wantActor: "token:", wantOK: true},
+		{name: "wrong token", auth: AdminAuth{Tokens: []string{"one"}}, token: "three"},
+		{name: "no credentials", auth: AdminAuth{Tokens: []string{"one"}}},
+		{name: "certificate of the admin CA", auth: AdminAuth{ClientCert: true, ClientCAs: adminCAs}, tls: peer(admin), wantActor: "cert:admin", wantOK: true},
+		{name: "certificate of another CA", auth: AdminAuth{ClientCert: true, ClientCAs: adminCAs}, tls: peer(stranger)},
+		{name: "certificate without client auth usage", auth: AdminAuth{ClientCert: true, ClientCAs: adminCAs}, tls: peer(serverOnly)},
+		{name: "name in the allowlist", auth: AdminAuth{ClientCert: true, ClientCAs: adminCAs, ClientNames: []string{"admin.example.com"}}, tls: peer(admin), wantActor: "cert:admin", wantOK: true},
+		{name: "name not in the allowlist", auth: AdminAuth{ClientCert: true, ClientCAs: adminCAs, ClientNames: []string{"ops"}}, tls: peer(admin)},
+		{name: "chain verified by the listener", auth: AdminAuth{ClientCert: true, ClientNames: []string{"stranger"}}, tls: verified(stranger), wantActor: "cert:stranger", wantOK: true},
+		{name: "chain not verified by the listener", auth: AdminAuth{ClientCert: true, ClientNames: []string{"stranger"}}, tls: peer(stranger)},
+		{name: "client certificates disabled", auth: AdminAuth{Tokens: []string{"one"}}, tls: verified(admin)},
+		{name: "rejected certificate falls back to the token", auth: AdminAuth{Tokens: []string{"one"}, ClientCert: true, ClientCAs: adminCAs}, token: "one", tls: peer(stranger), wantActor: "token:", wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(nil, nil, nil, nil)
+			h.AdminAuth = tt.auth
+			req := httptest.NewRequest(http.MethodGet, "/admin/revocations", nil)
+			if tt.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			req.TLS = tt.tls
+
+			actor, ok := h.authenticate(echo.New().NewContext(req, httptest.NewRecorder()))
+			if ok != tt.wantOK {
+				t.Fatalf("authenticate() ok = %t, want %t", ok, tt.wantOK)
+			}
+			if !strings.HasPrefix(actor, tt.wantActor) {
+				t.Errorf("authenticate() actor = %q, want it to start with %q", actor, tt.wantActor)
+			}
+			if strings.Contains(actor, tt.token) && tt.token != "" {
+				t.Errorf("the actor %q reveals the token", actor)
+			}
+		})
+	}
+}
+
+func TestAdminUnauthorized(t *testing.T) {
+	h := NewHandler(nil, nil, nil, nil)
+	h.AdminAuth = AdminAuth{Tokens: []string{"secret"}}
+	e := echo.New()
+	h.RegisterAdmin(e.Group("/admin"))
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+	}{
+		{name: "without token", wantCode: http.StatusUnauthorized},
+		{name: "with token", token: "secret", wantCode: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/revocations", nil)
+			if tt.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status code = %d, want %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
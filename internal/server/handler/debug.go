@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/scncore/scncore-ocsp-responder/internal/models"
+	"golang.org/x/crypto/ocsp"
+)
+
+// DebugView explains how the responder answers a request
+type DebugView struct {
+	Request  DebugRequest   `json:"request"`
+	Issuer   DebugIssuer    `json:"issuer"`
+	Decision DebugDecision  `json:"decision"`
+	Response *DebugResponse `json:"response,omitempty"`
+}
+
+type DebugRequest struct {
+	HashAlgorithm  string `json:"hash_algorithm"`
+	IssuerNameHash string `json:"issuer_name_hash"`
+	IssuerKeyHash  string `json:"issuer_key_hash"`
+	SerialNumber   string `json:"serial_number"`
+	SerialHex      string `json:"serial_hex"`
+}
+
+type DebugIssuer struct {
+	Subject string `json:"subject"`
+	Matched bool   `json:"matched"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DebugDecision is the status answered and where it comes from: database
+// or default when the responder couldn't look it up
+type DebugDecision struct {
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+	Source     string `json:"source"`
+	Error      string `json:"error,omitempty"`
+	HTTPStatus int    `json:"http_status"`
+}
+
+type DebugResponse struct {
+	Status             string    `json:"status"`
+	SerialNumber       string    `json:"serial_number"`
+	ProducedAt         time.Time `json:"produced_at"`
+	ThisUpdate         time.Time `json:"this_update"`
+	NextUpdate         time.Time `json:"next_update"`
+	RevokedAt          time.Time `json:"revoked_at,omitzero"`
+	RevocationReason   string    `json:"revocation_reason,omitempty"`
+	ResponderName      string    `json:"responder_name,omitempty"`
+	ResponderKeyHash   string    `json:"responder_key_hash,omitempty"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	Certificate        string    `json:"certificate,omitempty"`
+	SHA256             string    `json:"sha256"`
+	DER                string    `json:"der"`
+}
+
+// Debug answers a GET-encoded request like Verify, but with a JSON view of
+// each step. Responses aren't audited
+func (h *Handler) Debug(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	if h.CACert == nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "the CA certificate has not been loaded")
+	}
+
+	req, code, _ := h.decodeRequest(c, strings.TrimPrefix(c.Request().URL.Path, "/debug/ocsp"))
+	if req == nil {
+		return echo.NewHTTPError(code, "could not decode the OCSP request")
+	}
+
+	view := DebugView{
+		Request: DebugRequest{
+			HashAlgorithm:  req.HashAlgorithm.String(),
+			IssuerNameHash: fmt.Sprintf("%X", req.IssuerNameHash),
+			IssuerKeyHash:  fmt.Sprintf("%X", req.IssuerKeyHash),
+			SerialNumber:   req.SerialNumber.String(),
+			SerialHex:      fmt.Sprintf("%X", req.SerialNumber),
+		},
+		Issuer: DebugIssuer{Subject: h.CACert.Subject.String(), Matched: true},
+	}
+
+	if err := verifyIssuer(ctx, h.CACert, req); err != nil {
+		view.Issuer.Matched = false
+		view.Issuer.Error = err.Error()
+		view.Decision = DebugDecision{Status: errorStatusNames[malformedRequest], Source: "default", HTTPStatus: http.StatusInternalServerError}
+		return c.JSON(http.StatusOK, view)
+	}
+
+	if h.Model() == nil {
+		view.Decision = DebugDecision{Status: errorStatusNames[tryLater], Source: "default", Error: "the responder is connecting with the database", HTTPStatus: http.StatusServiceUnavailable}
+		return c.JSON(http.StatusOK, view)
+	}
+
+	responseTemplate, err := h.createResponseTemplate(ctx, req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		view.Decision = DebugDecision{Status: errorStatusNames[tryLater], Source: "default", Error: err.Error(), HTTPStatus: http.StatusServiceUnavailable}
+		return c.JSON(http.StatusOK, view)
+	}
+
+	// an unknown status means the lookup failed
+	view.Decision.Source = "database"
+	if responseTemplate.Status == ocsp.Unknown {
+		view.Decision.Source = "default"
+		view.Decision.Error = "the revocation lookup failed, see the responder log"
+	}
+
+	response, err := ocsp.CreateResponse(h.CACert, h.OCSPCert, responseTemplate, h.OCSPKey)
+	if err != nil {
+		view.Decision = DebugDecision{Status: errorStatusNames[internalError], Source: "default", Error: err.Error(), HTTPStatus: http.StatusInternalServerError}
+		return c.JSON(http.StatusOK, view)
+	}
+
+	view.Decision.Status = statusNames[responseTemplate.Status]
+	view.Decision.HTTPStatus = http.StatusOK
+	if responseTemplate.Status == ocsp.Revoked {
+		view.Decision.Reason = models.ReasonName(responseTemplate.RevocationReason)
+	}
+
+	decoded, err := newDebugResponse(response, h.CACert)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintf("could not decode the signed response: %v", err))
+	}
+	view.Response = decoded
+	return c.JSON(http.StatusOK, view)
+}
+
+func newDebugResponse(der []byte, issuer *x509.Certificate) (*DebugResponse, error) {
+	r, err := ocsp.ParseResponse(der, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	view := DebugResponse{
+		Status:             statusNames[r.Status],
+		SerialNumber:       r.SerialNumber.String(),
+		ProducedAt:         r.ProducedAt,
+		ThisUpdate:         r.ThisUpdate,
+		NextUpdate:         r.NextUpdate,
+		SignatureAlgorithm: r.SignatureAlgorithm.String(),
+		SHA256:             fmt.Sprintf("%x", sha256.Sum256(der)),
+		DER:                base64.StdEncoding.EncodeToString(der),
+	}
+	if r.Status == ocsp.Revoked {
+		view.RevokedAt = r.RevokedAt
+		view.RevocationReason = models.ReasonName(r.RevocationReason)
+	}
+	if len(r.RawResponderName) > 0 {
+		var name pkix.RDNSequence
+		if _, err := asn1.Unmarshal(r.RawResponderName, &name); err == nil {
+			view.ResponderName = name.String()
+		}
+	}
+	if len(r.ResponderKeyHash) > 0 {
+		view.ResponderKeyHash = fmt.Sprintf("%X", r.ResponderKeyHash)
+	}
+	if r.Certificate != nil {
+		view.Certificate = r.Certificate.Subject.String()
+	}
+	return &view, nil
+}
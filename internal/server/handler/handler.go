@@ -1,24 +1,71 @@
 package handler
 
 import (
-	"crypto/rsa"
+	"crypto"
 	"crypto/x509"
+	"sync/atomic"
+	"time"
 
+	"github.com/scncore/scncore-ocsp-responder/internal/audit"
 	"github.com/scncore/scncore-ocsp-responder/internal/models"
 )
 
+// DefaultLookupTimeout is the deadline for a revocation lookup unless
+// another one is configured
+const DefaultLookupTimeout = 5 * time.Second
+
+// Validity sets the thisUpdate and nextUpdate fields of signed responses
+type Validity struct {
+	// NextUpdate is added to the signing time
+	NextUpdate time.Duration
+	// ThisUpdatePrecision truncates the signing time, so responses signed
+	// within the same interval share their thisUpdate
+	ThisUpdatePrecision time.Duration
+}
+
+// DefaultValidity keeps responses valid for a day
+var DefaultValidity = Validity{NextUpdate: 24 * time.Hour, ThisUpdatePrecision: time.Hour}
+
 type Handler struct {
-	Model    *models.Model
-	CACert   *x509.Certificate
-	OCSPCert *x509.Certificate
-	OCSPKey  *rsa.PrivateKey
+	model         atomic.Pointer[models.Model]
+	CACert        *x509.Certificate
+	OCSPCert      *x509.Certificate
+	OCSPKey       crypto.Signer
+	LookupTimeout time.Duration
+	Limits        Limits
+	Validity      Validity
+	// Jobs reports the state of the worker's scheduled jobs
+	Jobs func() []JobState
+	// AdminAuth enables the admin API when credentials are set
+	AdminAuth AdminAuth
+	// Audit records every signed response when set
+	Audit *audit.Logger
+	// DebugRoute serves /debug/ocsp/, a JSON view of the response to a
+	// GET-encoded request
+	DebugRoute bool
 }
 
-func NewHandler(model *models.Model, caCert *x509.Certificate, ocspCert *x509.Certificate, ocspKey *rsa.PrivateKey) *Handler {
-	return &Handler{
-		Model:    model,
-		CACert:   caCert,
-		OCSPCert: ocspCert,
-		OCSPKey:  ocspKey,
+func NewHandler(model *models.Model, caCert *x509.Certificate, ocspCert *x509.Certificate, ocspKey crypto.Signer) *Handler {
+	h := Handler{
+		CACert:        caCert,
+		OCSPCert:      ocspCert,
+		OCSPKey:       ocspKey,
+		LookupTimeout: DefaultLookupTimeout,
+		Limits:        Limits{MaxRequestSize: DefaultMaxRequestSize},
+		Validity:      DefaultValidity,
+	}
+	if model != nil {
+		h.SetModel(model)
 	}
+	return &h
+}
+
+// SetModel makes the handler serve lookups once the database is connected,
+// until then OCSP requests are answered with tryLater
+func (h *Handler) SetModel(model *models.Model) {
+	h.model.Store(model)
+}
+
+func (h *Handler) Model() *models.Model {
+	return h.model.Load()
 }
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	healthOK   = "ok"
+	healthFail = "fail"
+)
+
+// HealthReport is the JSON document returned by /healthz and /readyz
+type HealthReport struct {
+	Status   string            `json:"status"`
+	Database DatabaseHealth    `json:"database"`
+	Signer   CertificateHealth `json:"signer"`
+	CA       CertificateHealth `json:"ca"`
+	Audit    AuditHealth       `json:"audit"`
+	Jobs     []JobState        `json:"jobs"`
+}
+
+type DatabaseHealth struct {
+	Status   string          `json:"status"`
+	Detail   string          `json:"detail,omitempty"`
+	Backends []BackendHealth `json:"backends,omitempty"`
+}
+
+type BackendHealth struct {
+	Name    string `json:"name"`
+	Replica bool   `json:"replica"`
+	Healthy bool   `json:"healthy"`
+}
+
+type CertificateHealth struct {
+	Status          string    `json:"status"`
+	Subject         string    `json:"subject,omitempty"`
+	NotAfter        time.Time `json:"not_after,omitzero"`
+	SecondsToExpiry int64     `json:"seconds_to_expiry,omitempty"`
+	Detail          string    `json:"detail,omitempty"`
+}
+
+// AuditHealth fails while signed responses go unaudited, i.e. when records
+// have been dropped or couldn't be written since the last successful batch
+type AuditHealth struct {
+	Status  string `json:"status"`
+	Dropped uint64 `json:"dropped"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// JobState describes one of the worker's scheduled jobs
+type JobState struct {
+	Name    string    `json:"name"`
+	State   string    `json:"state"`
+	LastRun time.Time `json:"last_run,omitzero"`
+	NextRun time.Time `json:"next_run,omitzero"`
+}
+
+// Liveness reports the health of the responder, it always answers 200 as
+// long as the process is able to serve requests. The database isn't pinged,
+// the report shows the state recorded by the last health check
+func (h *Handler) Liveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.Report())
+}
+
+// Readiness answers 503 while the responder can't sign valid responses,
+// i.e. while the worker is still connecting with the database, when no
+// database backend passed the last health check, when a certificate has
+// expired or when signed responses go unaudited. Like Liveness it doesn't
+// ping the database, so probes can't add load to it
+func (h *Handler) Readiness(c echo.Context) error {
+	report := h.Report()
+	if report.Status != healthOK {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// Report is the report answered by /healthz and /readyz, it relies on the
+// state of the database backends recorded by the last health check
+func (h *Handler) Report() HealthReport {
+	report := HealthReport{
+		Database: h.databaseHealth(),
+		Signer:   certificateHealth(h.OCSPCert),
+		CA:       certificateHealth(h.CACert),
+		Audit:    h.auditHealth(),
+		Jobs:     []JobState{},
+	}
+	if h.Jobs != nil {
+		report.Jobs = h.Jobs()
+	}
+
+	report.Status = healthOK
+	for _, status := range []string{report.Database.Status, report.Signer.Status, report.CA.Status, report.Audit.Status} {
+		if status == healthFail {
+			report.Status = healthFail
+		}
+	}
+	return report
+}
+
+func (h *Handler) databaseHealth() DatabaseHealth {
+	model := h.Model()
+	if model == nil {
+		return DatabaseHealth{Status: healthFail, Detail: "connecting with database"}
+	}
+
+	health := DatabaseHealth{Status: healthFail, Detail: "no database backend is reachable"}
+	for _, b := range model.Stats() {
+		health.Backends = append(health.Backends, BackendHealth{Name: b.Name, Replica: b.Replica, Healthy: b.Healthy})
+		if b.Healthy {
+			health.Status = healthOK
+			health.Detail = ""
+		}
+	}
+	return health
+}
+
+func certificateHealth(cert *x509.Certificate) CertificateHealth {
+	if cert == nil {
+		return CertificateHealth{Status: healthFail, Detail: "certificate has not been loaded"}
+	}
+
+	health := CertificateHealth{
+		Status:          healthOK,
+		Subject:         cert.Subject.String(),
+		NotAfter:        cert.NotAfter,
+		SecondsToExpiry: int64(time.Until(cert.NotAfter).Seconds()),
+	}
+	if health.SecondsToExpiry <= 0 {
+		health.Status = healthFail
+		health.Detail = "certificate has expired"
+	}
+	return health
+}
+
+func (h *Handler) auditHealth() AuditHealth {
+	if h.Audit == nil {
+		return AuditHealth{Status: "disabled"}
+	}
+
+	health := AuditHealth{Status: healthOK, Dropped: h.Audit.Dropped()}
+	if failure := h.Audit.Failure(); failure != "" {
+		health.Status = healthFail
+		health.Detail = failure
+	}
+	return health
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/scncore/scncore-ocsp-responder/internal/audit"
+)
+
+// newTestCertificate returns a self-signed certificate valid until notAfter
+func newTestCertificate(t *testing.T, name string, notAfter time.Time) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    notAfter.Add(-48 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(ctx context.Context, records []audit.Record) error {
+	return errors.New("disk full")
+}
+
+func (failingSink) Close() error {
+	return nil
+}
+
+// failingAudit returns a logger whose sink has already failed to write
+func failingAudit(t *testing.T) *audit.Logger {
+	t.Helper()
+
+	l := audit.NewLogger(failingSink{}, audit.Config{FlushInterval: time.Millisecond})
+	t.Cleanup(func() { l.Close(context.Background()) })
+	l.Log(audit.Record{Serial: "1"})
+	for deadline := time.Now().Add(5 * time.Second); l.Failure() == ""; {
+		if time.Now().After(deadline) {
+			t.Fatal("the audit logger hasn't reported the write failure")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return l
+}
+
+func TestReport(t *testing.T) {
+	valid := newTestCertificate(t, "valid", time.Now().Add(24*time.Hour))
+	expired := newTestCertificate(t, "expired", time.Now().Add(-time.Hour))
+
+	tests := []struct {
+		name         string
+		handler      func(t *testing.T) *Handler
+		wantStatus   string
+		wantDatabase string
+		wantSigner   string
+		wantCA       string
+		wantAudit    string
+	}{
+		{
+			name: "connecting with database",
+			handler: func(t *testing.T) *Handler {
+				return NewHandler(nil, valid, valid, nil)
+			},
+			wantStatus:   healthFail,
+			wantDatabase: healthFail,
+			wantSigner:   healthOK,
+			wantCA:       healthOK,
+			wantAudit:    "disabled",
+		},
+		{
+			name: "expired signer certificate",
+			handler: func(t *testing.T) *Handler {
+				return NewHandler(nil, valid, expired, nil)
+			},
+			wantStatus:   healthFail,
+			wantDatabase: healthFail,
+			wantSigner:   healthFail,
+			wantCA:       healthOK,
+			wantAudit:    "disabled",
+		},
+		{
+			name: "CA certificate not loaded",
+			handler: func(t *testing.T) *Handler {
+				return NewHandler(nil, nil, valid, nil)
+			},
+			wantStatus:   healthFail,
+			wantDatabase: healthFail,
+			wantSigner:   healthOK,
+			wantCA:       healthFail,
+			wantAudit:    "disabled",
+		},
+		{
+			name: "audit failing",
+			handler: func(t *testing.T) *Handler {
+				h := NewHandler(nil, valid, valid, nil)
+				h.Audit = failingAudit(t)
+				return h
+			},
+			wantStatus:   healthFail,
+			wantDatabase: healthFail,
+			wantSigner:   healthOK,
+			wantCA:       healthOK,
+			wantAudit:    healthFail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := tt.handler(t).Report()
+			if report.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q", report.Status, tt.wantStatus)
+			}
+			if report.Database.Status != tt.wantDatabase {
+				t.Errorf("Database.Status = %q, want %q", report.Database.Status, tt.wantDatabase)
+			}
+			if report.Database.Detail != "connecting with database" {
+				t.Errorf("Database.Detail = %q, want connecting with database", report.Database.Detail)
+			}
+			if report.Signer.Status != tt.wantSigner {
+				t.Errorf("Signer.Status = %q, want %q", report.Signer.Status, tt.wantSigner)
+			}
+			if report.CA.Status != tt.wantCA {
+				t.Errorf("CA.Status = %q, want %q", report.CA.Status, tt.wantCA)
+			}
+			if report.Audit.Status != tt.wantAudit {
+				t.Errorf("Audit.Status = %q, want %q", report.Audit.Status, tt.wantAudit)
+			}
+			if report.Jobs == nil {
+				t.Error("Jobs is nil, want an empty list")
+			}
+		})
+	}
+}
+
+func TestLivenessAndReadiness(t *testing.T) {
+	h := NewHandler(nil, nil, nil, nil)
+	e := echo.New()
+
+	tests := []struct {
+		name       string
+		route      echo.HandlerFunc
+		wantStatus int
+	}{
+		{name: "liveness", route: h.Liveness, wantStatus: http.StatusOK},
+		{name: "readiness", route: h.Readiness, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+			if err := tt.route(c); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status code = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var report HealthReport
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatalf("the body isn't a health report: %v", err)
+			}
+			if report.Status != healthFail {
+				t.Errorf("Status = %q, want %q", report.Status, healthFail)
+			}
+		})
+	}
+}
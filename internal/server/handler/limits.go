@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+)
+
+// DefaultMaxRequestSize is the largest DER request accepted unless another
+// limit is configured, real OCSP requests are a few hundred bytes
+const DefaultMaxRequestSize = 4096
+
+// Limits protects the OCSP routes from abusive clients. A zero
+// MaxRequestSize accepts requests of any size, a zero Rate disables rate
+// limiting, clients in Allowlist are never rate limited
+type Limits struct {
+	MaxRequestSize int64
+	Rate           float64
+	Burst          int
+	Allowlist      []netip.Prefix
+}
+
+// ParseAllowlist parses a list of CIDRs or single addresses
+func ParseAllowlist(networks []string) ([]netip.Prefix, error) {
+	allowlist := []netip.Prefix{}
+	for _, network := range networks {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(network)
+			if addrErr != nil {
+				return nil, fmt.Errorf("could not parse network %s in the allowlist: %v", network, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		allowlist = append(allowlist, prefix.Masked())
+	}
+	return allowlist, nil
+}
+
+// maxEncodedSize is the length of a GET path able to hold a request of
+// MaxRequestSize bytes once base64 encoded, including the leading slash
+func (l Limits) maxEncodedSize() int {
+	return int((l.MaxRequestSize+2)/3*4) + 1
+}
+
+// RateLimiter answers tryLater to clients exceeding their token bucket
+func (h *Handler) RateLimiter() echo.MiddlewareFunc {
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Skipper: func(c echo.Context) bool {
+			addr, err := netip.ParseAddr(c.RealIP())
+			if err != nil {
+				return false
+			}
+			for _, prefix := range h.Limits.Allowlist {
+				if prefix.Contains(addr.Unmap()) {
+					return true
+				}
+			}
+			return false
+		},
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:      rate.Limit(h.Limits.Rate),
+			Burst:     max(h.Limits.Burst, 1),
+			ExpiresIn: 3 * time.Minute,
+		}),
+		IdentifierExtractor: func(c echo.Context) (string, error) {
+			return c.RealIP(), nil
+		},
+		DenyHandler: func(c echo.Context, identifier string, err error) error {
+			return sendOCSPError(c, http.StatusTooManyRequests, tryLater)
+		},
+	})
+}
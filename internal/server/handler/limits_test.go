@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestParseAllowlist(t *testing.T) {
+	tests := []struct {
+		name     string
+		networks []string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "empty", networks: nil, want: []string{}},
+		{name: "CIDRs", networks: []string{"10.0.0.0/8", "2001:db8::/32"}, want: []string{"10.0.0.0/8", "2001:db8::/32"}},
+		{name: "single addresses", networks: []string{"192.0.2.7", "::1"}, want: []string{"192.0.2.7/32", "::1/128"}},
+		{name: "masked", networks: []string{"192.0.2.7/24"}, want: []string{"192.0.2.0/24"}},
+		{name: "invalid", networks: []string{"example.com"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowlist, err := ParseAllowlist(tt.networks)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAllowlist() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			got := []string{}
+			for _, prefix := range allowlist {
+				got = append(got, prefix.String())
+			}
+			if err == nil && !slices.Equal(got, tt.want) {
+				t.Errorf("ParseAllowlist() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name     string
+		client   string
+		requests int
+		want429  bool
+	}{
+		{name: "burst exceeded", client: "192.0.2.1", requests: 3, want429: true},
+		{name: "allowlisted client", client: "198.51.100.7", requests: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(nil, nil, nil, nil)
+			h.Limits.Rate = 0.001
+			h.Limits.Burst = 2
+			h.Limits.Allowlist = []netip.Prefix{netip.MustParsePrefix("198.51.100.0/24")}
+			e := echo.New()
+			e.IPExtractor = echo.ExtractIPDirect()
+			h.Register(e, false)
+
+			limited := false
+			for i := 0; i < tt.requests; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/MAo=", nil)
+				req.RemoteAddr = tt.client + ":40000"
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+				if rec.Code != http.StatusTooManyRequests {
+					continue
+				}
+				limited = true
+				if i < h.Limits.Burst {
+					t.Errorf("request %d has been rate limited within the burst", i+1)
+				}
+				if want := []byte{0x30, 0x03, 0x0A, 0x01, tryLater}; !bytes.Equal(rec.Body.Bytes(), want) {
+					t.Errorf("body = %x, want the tryLater response %x", rec.Body.Bytes(), want)
+				}
+			}
+			if limited != tt.want429 {
+				t.Errorf("rate limited = %t, want %t", limited, tt.want429)
+			}
+		})
+	}
+}
+
+func TestDecodeRequestSize(t *testing.T) {
+	cert := newTestCertificate(t, "issuer", time.Now().Add(time.Hour))
+	der, err := ocsp.CreateRequest(cert, cert, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := "/" + base64.StdEncoding.EncodeToString(der)
+	large := append(bytes.Repeat([]byte{0}, 8192), der...)
+
+	tests := []struct {
+		name     string
+		limit    int64
+		method   string
+		path     string
+		body     []byte
+		wantCode int
+	}{
+		{name: "POST within limit", limit: DefaultMaxRequestSize, method: http.MethodPost, path: "/", body: der},
+		{name: "GET within limit", limit: DefaultMaxRequestSize, method: http.MethodGet, path: encoded},
+		{name: "GET at the exact limit", limit: int64(len(der)), method: http.MethodGet, path: encoded},
+		{name: "POST too large", limit: int64(len(der)) - 1, method: http.MethodPost, path: "/", body: der, wantCode: http.StatusRequestEntityTooLarge},
+		{name: "GET too long", limit: 16, method: http.MethodGet, path: encoded, wantCode: http.StatusRequestURITooLong},
+		{name: "no limit", limit: 0, method: http.MethodPost, path: "/", body: large, wantCode: http.StatusInternalServerError},
+		{name: "not base64", limit: DefaultMaxRequestSize, method: http.MethodGet, path: "/" + strings.Repeat("!", 8), wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(nil, nil, nil, nil)
+			h.Limits.MaxRequestSize = tt.limit
+			c := echo.New().NewContext(httptest.NewRequest(tt.method, tt.path, bytes.NewReader(tt.body)), httptest.NewRecorder())
+
+			req, code, _ := h.decodeRequest(c, tt.path)
+			if code != tt.wantCode {
+				t.Fatalf("decodeRequest() code = %d, want %d", code, tt.wantCode)
+			}
+			if tt.wantCode == 0 && (req == nil || req.SerialNumber.Cmp(cert.SerialNumber) != 0) {
+				t.Errorf("decodeRequest() = %v, want the request for serial %s", req, cert.SerialNumber)
+			}
+		})
+	}
+}
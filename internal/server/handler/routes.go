@@ -2,9 +2,33 @@ package handler
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func (h *Handler) Register(e *echo.Echo) {
-	e.GET("/*", h.Verify)
-	e.POST("/", h.Verify)
+// Register adds the OCSP, health and metrics routes, the debug route if
+// enabled, and the admin API under /admin if withAdmin is set and admin
+// credentials are configured
+func (h *Handler) Register(e *echo.Echo, withAdmin bool) {
+	e.Use(RequestID(), AccessLog)
+
+	if withAdmin && h.AdminAuth.Enabled() {
+		h.RegisterAdmin(e.Group("/admin"))
+	}
+
+	e.GET("/healthz", h.Liveness)
+	e.GET("/readyz", h.Readiness)
+	// kept for probes configured before /healthz existed
+	e.GET("/health", h.Liveness)
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	ocspMiddleware := []echo.MiddlewareFunc{}
+	if h.Limits.Rate > 0 {
+		ocspMiddleware = append(ocspMiddleware, h.RateLimiter())
+	}
+
+	if h.DebugRoute {
+		e.GET("/debug/ocsp/*", h.Debug, ocspMiddleware...)
+	}
+	e.GET("/*", h.Verify, ocspMiddleware...)
+	e.POST("/", h.Verify, ocspMiddleware...)
 }
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -10,92 +11,199 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/scncore/ent"
+	"github.com/scncore/scncore-ocsp-responder/internal/audit"
+	"github.com/scncore/scncore-ocsp-responder/internal/logging"
+	"github.com/scncore/scncore-ocsp-responder/internal/metrics"
+	"github.com/scncore/scncore-ocsp-responder/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/ocsp"
 )
 
 var (
 	malformedRequest = byte(1)
 	internalError    = byte(2)
+	tryLater         = byte(3)
 )
 
-func (h *Handler) Verify(c echo.Context) error {
-	var req *ocsp.Request
-	var requestBody []byte
-	var err error
-
-	if c.Request().Method == "POST" {
-		requestBody, err = io.ReadAll(c.Request().Body)
-		if err != nil {
-			return sendOCSPError(c, http.StatusBadRequest, malformedRequest)
-		}
+// names used as the status label of the requests metric
+var (
+	statusNames = map[int]string{
+		ocsp.Good:    "good",
+		ocsp.Revoked: "revoked",
+		ocsp.Unknown: "unknown",
 	}
+	errorStatusNames = map[byte]string{
+		malformedRequest: "malformed_request",
+		internalError:    "internal_error",
+		tryLater:         "try_later",
+	}
+)
 
-	if c.Request().Method == "GET" {
-		uri := c.Request().URL.Path
-		if strings.Contains(uri, "health") {
-			return healthCheck(c, h)
-		}
+func (h *Handler) Verify(c echo.Context) error {
+	// continue the trace of the caller, if any
+	ctx := tracing.Extract(c.Request().Context(), propagation.HeaderCarrier(c.Request().Header))
+	ctx, span := tracing.Start(ctx, "ocsp.verify", trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("http.request.method", c.Request().Method)))
+	defer span.End()
+	c.SetRequest(c.Request().WithContext(ctx))
 
-		requestBody, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, "/"))
-		if err != nil {
-			return sendOCSPError(c, http.StatusBadRequest, malformedRequest)
-		}
+	// Decode and parse request
+	start := time.Now()
+	_, decodeSpan := tracing.Start(ctx, "ocsp.decode")
+	req, code, status := h.decodeRequest(c, c.Request().URL.Path)
+	decodeSpan.End()
+	if req == nil {
+		return sendOCSPError(c, code, status)
 	}
+	metrics.ObservePhase("parse", start)
+	c.Set(issuerKey, fmt.Sprintf("%X", req.IssuerKeyHash))
+	c.Set(serialKey, req.SerialNumber.String())
+	span.SetAttributes(attribute.String("ocsp.serial", req.SerialNumber.String()), attribute.String("ocsp.issuer_key_hash", fmt.Sprintf("%X", req.IssuerKeyHash)))
 
-	// Parse request
-	req, err = ocsp.ParseRequest(requestBody)
+	// Verify issuer name and key hashes
+	issuerCtx, issuerSpan := tracing.Start(ctx, "ocsp.issuer_check")
+	err := verifyIssuer(issuerCtx, h.CACert, req)
+	endSpan(issuerSpan, err)
 	if err != nil {
-		return sendOCSPError(c, http.StatusInternalServerError, internalError)
+		return sendOCSPError(c, http.StatusInternalServerError, malformedRequest)
 	}
 
-	// Verify issuer name and key hashes
-	if err := verifyIssuer(h.CACert, req); err != nil {
-		return sendOCSPError(c, http.StatusInternalServerError, malformedRequest)
+	// the database may still be connecting
+	if h.Model() == nil {
+		return sendOCSPError(c, http.StatusServiceUnavailable, tryLater)
 	}
 
 	// create response template
-	responseTemplate := h.createResponseTemplate(req)
+	responseTemplate, err := h.createResponseTemplate(ctx, req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			// the client has gone away, there's no one to answer
+			return nil
+		}
+		return sendOCSPError(c, http.StatusServiceUnavailable, tryLater)
+	}
 
 	// make a response to return
+	start = time.Now()
+	_, signSpan := tracing.Start(ctx, "ocsp.sign")
 	response, err := ocsp.CreateResponse(h.CACert, h.OCSPCert, responseTemplate, h.OCSPKey)
+	endSpan(signSpan, err)
 	if err != nil {
 		return sendOCSPError(c, http.StatusInternalServerError, internalError)
 	}
+	metrics.ObservePhase("sign", start)
 
 	// send response
+	h.auditResponse(c, responseTemplate, response)
 	return sendOCSPResponse(c, responseTemplate, response)
 }
 
+// decodeRequest reads the DER request from the POST body or, base64
+// encoded, from the GET path. When it fails it returns a nil request with
+// the HTTP code and the OCSP status to answer with
+func (h *Handler) decodeRequest(c echo.Context, path string) (*ocsp.Request, int, byte) {
+	var requestBody []byte
+	var err error
+
+	if c.Request().Method == "POST" {
+		var body io.Reader = c.Request().Body
+		if h.Limits.MaxRequestSize > 0 {
+			body = io.LimitReader(body, h.Limits.MaxRequestSize+1)
+		}
+		requestBody, err = io.ReadAll(body)
+		if err != nil {
+			return nil, http.StatusBadRequest, malformedRequest
+		}
+		if h.Limits.MaxRequestSize > 0 && int64(len(requestBody)) > h.Limits.MaxRequestSize {
+			return nil, http.StatusRequestEntityTooLarge, tryLater
+		}
+	}
+
+	if c.Request().Method == "GET" {
+		uri := path
+		if h.Limits.MaxRequestSize > 0 && len(uri) > h.Limits.maxEncodedSize() {
+			return nil, http.StatusRequestURITooLong, tryLater
+		}
+
+		requestBody, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, "/"))
+		if err != nil {
+			return nil, http.StatusBadRequest, malformedRequest
+		}
+	}
+
+	req, err := ocsp.ParseRequest(requestBody)
+	if err != nil {
+		return nil, http.StatusInternalServerError, internalError
+	}
+	return req, 0, 0
+}
+
 func sendOCSPError(c echo.Context, code int, status byte) error {
+	metrics.Requests.WithLabelValues(c.Request().Method, errorStatusNames[status]).Inc()
+	c.Set(statusKey, errorStatusNames[status])
+
+	span := trace.SpanFromContext(c.Request().Context())
+	span.SetAttributes(attribute.String("ocsp.status", errorStatusNames[status]), attribute.Int("http.response.status_code", code))
+	span.SetStatus(codes.Error, errorStatusNames[status])
+
+	_, writeSpan := tracing.Start(c.Request().Context(), "ocsp.write")
+	defer writeSpan.End()
 	c.Response().Status = code
 	// Reference: https://github.com/cloudflare/cfssl/blob/master/ocsp/responder.go#L33
 	c.Response().Write([]byte{0x30, 0x03, 0x0A, 0x01, status})
 	return nil
 }
 
-func (h *Handler) createResponseTemplate(req *ocsp.Request) ocsp.Response {
+// endSpan ends a span, recording the error of the step it covers
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (h *Handler) createResponseTemplate(ctx context.Context, req *ocsp.Request) (ocsp.Response, error) {
 	serial := req.SerialNumber
+	now := time.Now()
 
 	// construct response template
 	responseTemplate := ocsp.Response{
 		SerialNumber: req.SerialNumber,
 		Certificate:  h.OCSPCert,
 		IssuerHash:   req.HashAlgorithm,
-		ThisUpdate:   time.Now().Truncate(time.Hour),
-		NextUpdate:   time.Now().AddDate(0, 0, 1).UTC(),
+		ThisUpdate:   now.Truncate(h.Validity.ThisUpdatePrecision),
+		NextUpdate:   now.Add(h.Validity.NextUpdate).UTC(),
 	}
 
 	// check if certificate has been revoked querying the database
-	revoked, err := h.Model.GetRevoked(serial.Int64())
+	ctx, cancel := context.WithTimeout(ctx, h.LookupTimeout)
+	defer cancel()
+
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "ocsp.lookup")
+	defer span.End()
+	revoked, err := h.Model().GetRevoked(ctx, serial.Int64())
+	metrics.ObservePhase("lookup", start)
+	if ctx.Err() != nil {
+		span.RecordError(ctx.Err())
+		span.SetStatus(codes.Error, ctx.Err().Error())
+		slog.ErrorContext(ctx, "revocation lookup has been aborted", "serial", serial, "reason", ctx.Err())
+		return responseTemplate, ctx.Err()
+	}
 	if err != nil && !ent.IsNotFound(err) {
-		log.Println("... could not check if certificate has been revoked")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "could not check if certificate has been revoked", "serial", serial, "reason", err)
 		responseTemplate.Status = ocsp.Unknown
 	} else {
 		// complete response based on status
@@ -108,10 +216,16 @@ func (h *Handler) createResponseTemplate(req *ocsp.Request) ocsp.Response {
 		}
 	}
 
-	return responseTemplate
+	return responseTemplate, nil
 }
 
 func sendOCSPResponse(c echo.Context, responseTemplate ocsp.Response, response []byte) error {
+	metrics.Requests.WithLabelValues(c.Request().Method, statusNames[responseTemplate.Status]).Inc()
+	c.Set(statusKey, statusNames[responseTemplate.Status])
+	trace.SpanFromContext(c.Request().Context()).SetAttributes(attribute.String("ocsp.status", statusNames[responseTemplate.Status]))
+
+	_, writeSpan := tracing.Start(c.Request().Context(), "ocsp.write")
+	defer writeSpan.End()
 	c.Response().Header().Add("Content-Type", "application/ocsp-response")
 	c.Response().Header().Add("Last-Modified", responseTemplate.ThisUpdate.Format(time.RFC1123))
 	c.Response().Header().Add("Expires", responseTemplate.NextUpdate.Format(time.RFC1123))
@@ -122,15 +236,27 @@ func sendOCSPResponse(c echo.Context, responseTemplate ocsp.Response, response [
 	return nil
 }
 
-func healthCheck(c echo.Context, h *Handler) error {
-	if _, err := h.Model.GetRevoked(0); err != nil {
-		if ent.IsNotFound(err) {
-			return c.String(http.StatusOK, "OCSP Responder is healthy")
-		} else {
-			return c.String(http.StatusInternalServerError, "OCSP Responder is not healthy")
-		}
+// auditResponse queues a record of the signed response if auditing is on
+func (h *Handler) auditResponse(c echo.Context, responseTemplate ocsp.Response, response []byte) {
+	if h.Audit == nil {
+		return
+	}
+
+	record := audit.Record{
+		Time:         time.Now(),
+		Serial:       responseTemplate.SerialNumber.String(),
+		Issuer:       fmt.Sprint(c.Get(issuerKey)),
+		Status:       statusNames[responseTemplate.Status],
+		ThisUpdate:   responseTemplate.ThisUpdate,
+		NextUpdate:   responseTemplate.NextUpdate,
+		ClientIP:     c.RealIP(),
+		ResponseHash: fmt.Sprintf("%x", sha256.Sum256(response)),
+		RequestID:    logging.RequestID(c.Request().Context()),
+	}
+	if responseTemplate.Status == ocsp.Revoked {
+		record.Reason = &responseTemplate.RevocationReason
 	}
-	return c.String(http.StatusOK, "OCSP Responder is healthy")
+	h.Audit.Log(record)
 }
 
 /* MIT License
@@ -155,11 +281,11 @@ LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
 OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
 SOFTWARE. */
 
-func verifyIssuer(caCert *x509.Certificate, req *ocsp.Request) error {
+func verifyIssuer(ctx context.Context, caCert *x509.Certificate, req *ocsp.Request) error {
 	h := req.HashAlgorithm.New()
 	h.Write(caCert.RawSubject)
 	if !bytes.Equal(h.Sum(nil), req.IssuerNameHash) {
-		log.Println("[INFO]: issuer name does not match")
+		slog.InfoContext(ctx, "issuer name does not match")
 		return errors.New("issuer name does not match")
 	}
 	h.Reset()
@@ -168,12 +294,12 @@ func verifyIssuer(caCert *x509.Certificate, req *ocsp.Request) error {
 		PublicKey asn1.BitString
 	}
 	if _, err := asn1.Unmarshal(caCert.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
-		log.Println("[INFO]: cannot unmarshall caCert.RawSubjectPublicKeyInfo")
+		slog.InfoContext(ctx, "cannot unmarshall caCert.RawSubjectPublicKeyInfo")
 		return err
 	}
 	h.Write(publicKeyInfo.PublicKey.RightAlign())
 	if !bytes.Equal(h.Sum(nil), req.IssuerKeyHash) {
-		log.Println("[INFO]: issuer key hash does not match")
+		slog.InfoContext(ctx, "issuer key hash does not match")
 		return errors.New("issuer key hash does not match")
 	}
 	return nil
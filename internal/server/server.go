@@ -1,10 +1,17 @@
 package server
 
 import (
-	"crypto/rsa"
+	"context"
+	"crypto"
+	"crypto/tls"
 	"crypto/x509"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/scncore/scncore-ocsp-responder/internal/models"
@@ -15,28 +22,213 @@ type WebServer struct {
 	Handler *handler.Handler
 	Server  *http.Server
 	Address string
+	// TLSConfig enables HTTPS on Address when set
+	TLSConfig *tls.Config
+	// PlainAddress keeps a plain HTTP listener for RFC 6960 clients when
+	// Address serves HTTPS
+	PlainAddress string
+	PlainServer  *http.Server
+	// AdminAddress serves the admin API on its own listener, using TLS if
+	// TLSConfig is set, instead of under /admin on Address
+	AdminAddress string
+	AdminServer  *http.Server
+	Timeouts     Timeouts
+	// Listening is called once every listener accepts connections
+	Listening func()
+	// Failed is called when the admin or plain HTTP listener stops serving
+	// before Shutdown, the error of Address is returned by Serve
+	Failed func(error)
 }
 
-func New(m *models.Model, address string, caCert *x509.Certificate, ocspCert *x509.Certificate, ocspKey *rsa.PrivateKey) *WebServer {
+// Timeouts are applied to every listener, zero values mean no timeout
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+	Idle  time.Duration
+}
+
+// DefaultTimeouts are used unless other timeouts are configured
+var DefaultTimeouts = Timeouts{
+	Read:  10 * time.Second,
+	Write: 10 * time.Second,
+	Idle:  60 * time.Second,
+}
+
+func New(m *models.Model, address string, caCert *x509.Certificate, ocspCert *x509.Certificate, ocspKey crypto.Signer) *WebServer {
 	w := WebServer{}
 	w.Handler = handler.NewHandler(m, caCert, ocspCert, ocspKey)
 	w.Address = address
+	w.Timeouts = DefaultTimeouts
 	return &w
 }
 
+// Prepare builds the HTTP servers without listening, it must be called
+// before Serve runs in its own goroutine so Shutdown reads the servers
+// without racing with Serve
+func (w *WebServer) Prepare() {
+	e := newEcho()
+	w.Handler.Register(e, w.AdminAddress == "")
+	w.Server = w.newHTTPServer(w.Address, e)
+	w.Server.TLSConfig = w.TLSConfig
+	if w.AdminAddress == "" {
+		w.Server.TLSConfig = w.adminTLSConfig(tls.RequestClientCert)
+	}
+
+	if w.AdminAddress != "" && w.Handler.AdminAuth.Enabled() {
+		admin := newEcho()
+		admin.Use(handler.RequestID(), handler.AccessLog)
+		w.Handler.RegisterAdmin(admin.Group("/admin"))
+		w.AdminServer = w.newHTTPServer(w.AdminAddress, admin)
+		w.AdminServer.TLSConfig = w.adminTLSConfig(tls.VerifyClientCertIfGiven)
+	}
+
+	if w.TLSConfig != nil && w.PlainAddress != "" {
+		// the plain HTTP listener never serves the admin API
+		plain := newEcho()
+		w.Handler.Register(plain, false)
+		w.PlainServer = w.newHTTPServer(w.PlainAddress, plain)
+	}
+}
+
+// Serve binds every listener before serving any of them, so an address in
+// use is returned instead of leaving the responder half started
 func (w *WebServer) Serve() error {
+	if w.Server == nil {
+		w.Prepare()
+	}
+
+	listeners := []net.Listener{}
+	listen := func(address string) (net.Listener, error) {
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+		return l, nil
+	}
+
+	listener, err := listen(w.Address)
+	if err != nil {
+		return err
+	}
+	var adminListener, plainListener net.Listener
+	if w.AdminServer != nil {
+		if adminListener, err = listen(w.AdminAddress); err != nil {
+			return err
+		}
+	}
+	if w.PlainServer != nil {
+		if plainListener, err = listen(w.PlainAddress); err != nil {
+			return err
+		}
+	}
+	if w.Listening != nil {
+		w.Listening()
+	}
+
+	if adminListener != nil {
+		if w.TLSConfig == nil {
+			slog.Warn("the admin API is served over plain HTTP, credentials can be sniffed", "address", w.AdminAddress)
+		}
+		go w.serveBackground("admin", w.AdminServer, adminListener, w.TLSConfig != nil)
+	}
+	if plainListener != nil {
+		go w.serveBackground("plain HTTP", w.PlainServer, plainListener, false)
+	}
+
+	if w.TLSConfig == nil {
+		if w.AdminAddress == "" && w.Handler.AdminAuth.Enabled() {
+			slog.Warn("the admin API is served over plain HTTP, credentials can be sniffed", "address", w.Address)
+		}
+		return w.Server.Serve(listener)
+	}
+	return w.Server.ServeTLS(listener, "", "")
+}
+
+// adminTLSConfig asks the clients of a listener serving the admin API for
+// the certificates of the admin client CA, if there's one. The listener of
+// the OCSP port only requests them, its clients mustn't fail the handshake
+// and the admin API verifies them anyway
+func (w *WebServer) adminTLSConfig(auth tls.ClientAuthType) *tls.Config {
+	admin := w.Handler.AdminAuth
+	if w.TLSConfig == nil || !admin.ClientCert || admin.ClientCAs == nil {
+		return w.TLSConfig
+	}
+
+	cfg := w.TLSConfig.Clone()
+	cfg.ClientAuth = auth
+	cfg.ClientCAs = admin.ClientCAs
+	return cfg
+}
+
+// newEcho returns an echo instance taking the client address from the
+// connection, rate limits are per client so it must not come from headers
+// a client can forge
+func newEcho() *echo.Echo {
 	e := echo.New()
-	w.Handler.Register(e)
-	w.Server = &http.Server{
-		Addr:    w.Address,
-		Handler: e,
+	e.IPExtractor = echo.ExtractIPDirect()
+	return e
+}
+
+// serveBackground serves the admin or plain HTTP listener, reporting to
+// Failed if it stops before Shutdown
+func (w *WebServer) serveBackground(name string, s *http.Server, l net.Listener, useTLS bool) {
+	var err error
+	if useTLS {
+		err = s.ServeTLS(l, "", "")
+	} else {
+		err = s.Serve(l)
+	}
+	if err == http.ErrServerClosed {
+		return
+	}
+
+	slog.Error("the "+name+" server has stopped", "reason", err)
+	if w.Failed != nil {
+		w.Failed(fmt.Errorf("the %s server has stopped: %v", name, err))
+	}
+}
+
+func (w *WebServer) newHTTPServer(address string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadTimeout:       w.Timeouts.Read,
+		ReadHeaderTimeout: w.Timeouts.Read,
+		WriteTimeout:      w.Timeouts.Write,
+		IdleTimeout:       w.Timeouts.Idle,
 	}
-	// e.Use(middleware.Logger()) // -> TODO set an env variable for debug
-	return w.Server.ListenAndServe()
 }
 
-func (w *WebServer) Close() {
-	if err := w.Server.Close(); err != nil {
-		log.Println("[ERROR]: could not shutdown web server")
+// Shutdown stops accepting new connections and waits for in-flight
+// requests to finish until ctx expires, then closes whatever is left
+func (w *WebServer) Shutdown(ctx context.Context) error {
+	servers := []*http.Server{}
+	if w.PlainServer != nil {
+		servers = append(servers, w.PlainServer)
 	}
+	if w.AdminServer != nil {
+		servers = append(servers, w.AdminServer)
+	}
+	if w.Server != nil {
+		servers = append(servers, w.Server)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(servers))
+	for i, s := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if errs[i] = s.Shutdown(ctx); errs[i] != nil {
+				s.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
 }
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeAddressInUse(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	tests := []struct {
+		name  string
+		setup func(w *WebServer)
+	}{
+		{
+			name: "OCSP address",
+			setup: func(w *WebServer) {
+				w.Address = busy.Addr().String()
+			},
+		},
+		{
+			name: "admin address",
+			setup: func(w *WebServer) {
+				w.Handler.AdminAuth.Tokens = []string{"secret"}
+				w.AdminAddress = busy.Addr().String()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := New(nil, freeAddress(t), nil, nil, nil)
+			tt.setup(w)
+			listening := false
+			w.Listening = func() { listening = true }
+
+			if err := w.Serve(); err == nil {
+				t.Fatal("Serve() succeeded on an address in use")
+			}
+			if listening {
+				t.Error("Listening has been called although a listener couldn't be bound")
+			}
+			// the listeners bound before the failure must have been closed
+			if w.Address != busy.Addr().String() {
+				l, err := net.Listen("tcp", w.Address)
+				if err != nil {
+					t.Fatalf("the OCSP address is still bound: %v", err)
+				}
+				l.Close()
+			}
+		})
+	}
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		release bool
+		wantErr bool
+	}{
+		{name: "request finishes", timeout: 5 * time.Second, release: true},
+		{name: "deadline expires", timeout: 50 * time.Millisecond, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			release := make(chan struct{})
+			defer func() {
+				select {
+				case <-release:
+				default:
+					close(release)
+				}
+			}()
+
+			w := New(nil, freeAddress(t), nil, nil, nil)
+			w.Prepare()
+			w.Server.Handler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				close(started)
+				<-release
+				io.WriteString(rw, "done")
+			})
+			listening := make(chan struct{})
+			w.Listening = func() { close(listening) }
+			served := make(chan error, 1)
+			go func() { served <- w.Serve() }()
+			<-listening
+
+			type result struct {
+				body string
+				err  error
+			}
+			responses := make(chan result, 1)
+			go func() {
+				resp, err := http.Get("http://" + w.Address + "/")
+				if err != nil {
+					responses <- result{err: err}
+					return
+				}
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				responses <- result{body: string(body), err: err}
+			}()
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			stopped := make(chan error, 1)
+			go func() { stopped <- w.Shutdown(ctx) }()
+
+			if tt.release {
+				select {
+				case err := <-stopped:
+					t.Fatalf("Shutdown() returned %v with a request in flight", err)
+				case <-time.After(20 * time.Millisecond):
+				}
+				close(release)
+			}
+
+			err := <-stopped
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Shutdown() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+				t.Errorf("Serve() error = %v, want %v", err, http.ErrServerClosed)
+			}
+
+			got := <-responses
+			if tt.wantErr {
+				if got.err == nil {
+					t.Error("the request has been answered although the deadline expired")
+				}
+				return
+			}
+			if got.err != nil || got.body != "done" {
+				t.Errorf("in-flight request = %q, %v, want it answered", got.body, got.err)
+			}
+		})
+	}
+}
+
+// freeAddress returns a loopback address nobody listens on
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSOptions describes the TLS listener. ClientAuth is "optional" to verify
+// client certificates when presented or "require" to reject clients
+// without one. CipherPolicy only applies to TLS 1.2, TLS 1.3 suites are
+// not configurable
+type TLSOptions struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	ClientAuth   string
+	MinVersion   string
+	CipherPolicy string
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func NewTLSConfig(o TLSOptions) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS certificate and key: %v", err)
+	}
+
+	cfg := tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if o.MinVersion != "" {
+		version, ok := tlsVersions[o.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS minimum version %s, use 1.2 or 1.3", o.MinVersion)
+		}
+		cfg.MinVersion = version
+	}
+
+	cfg.CipherSuites, err = cipherSuites(o.CipherPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.ClientCAFile != "" {
+		cfg.ClientCAs, err = LoadCertPool(o.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		switch o.ClientAuth {
+		case "", "optional":
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		case "require":
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		default:
+			return nil, fmt.Errorf("unsupported client auth mode %s, use optional or require", o.ClientAuth)
+		}
+	}
+
+	return &cfg, nil
+}
+
+// LoadCertPool reads a bundle of client CA certificates in PEM format
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client CA bundle: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client CA bundle %s has no valid certificates", path)
+	}
+	return pool, nil
+}
+
+// cipherSuites returns the TLS 1.2 suites for a policy. "default" keeps Go's
+// choice, "modern" only allows forward secret AEAD suites
+func cipherSuites(policy string) ([]uint16, error) {
+	switch policy {
+	case "", "default":
+		return nil, nil
+	case "modern":
+		return []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported cipher policy %s, use default or modern", policy)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key in PEM
+// format to dir and returns their paths
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "tls.cer")
+	keyFile := filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir)
+	emptyBundle := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(emptyBundle, []byte("no certificates\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options TLSOptions
+		wantErr bool
+		check   func(t *testing.T, cfg *tls.Config)
+	}{
+		{
+			name:    "defaults",
+			options: TLSOptions{CertFile: certFile, KeyFile: keyFile},
+			check: func(t *testing.T, cfg *tls.Config) {
+				if cfg.MinVersion != tls.VersionTLS12 {
+					t.Errorf("MinVersion = %x, want TLS 1.2", cfg.MinVersion)
+				}
+				if cfg.CipherSuites != nil {
+					t.Errorf("CipherSuites = %v, want Go's defaults", cfg.CipherSuites)
+				}
+				if cfg.ClientAuth != tls.NoClientCert || cfg.ClientCAs != nil {
+					t.Errorf("ClientAuth = %v, want no client certificates", cfg.ClientAuth)
+				}
+			},
+		},
+		{
+			name:    "TLS 1.3",
+			options: TLSOptions{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3"},
+			check: func(t *testing.T, cfg *tls.Config) {
+				if cfg.MinVersion != tls.VersionTLS13 {
+					t.Errorf("MinVersion = %x, want TLS 1.3", cfg.MinVersion)
+				}
+			},
+		},
+		{
+			name:    "unsupported version",
+			options: TLSOptions{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.0"},
+			wantErr: true,
+		},
+		{
+			name:    "modern ciphers",
+			options: TLSOptions{CertFile: certFile, KeyFile: keyFile, CipherPolicy: "modern"},
+			check: func(t *testing.T, cfg *tls.Config) {
+				if len(cfg.CipherSuites) == 0 {
+					t.Fatal("CipherSuites is empty, want the modern suites")
+				}
+				for _, id := range cfg.CipherSuites {
+					for _, insecure := range tls.InsecureCipherSuites() {
+						if id == insecure.ID {
+							t.Errorf("the modern policy allows the insecure suite %s", insecure.Name)
+						}
+					}
+				}
+			},
+		},
+		{
+			name:    "unsupported cipher policy",
+			options: TLSOptions{CertFile: certFile, KeyFile: keyFile, CipherPolicy: "legacy"},
+			wantErr: true,
+		},
+		{
+			name:    "optional client certificates",
+			options: TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile},
+			check: func(t *testing.T, cfg *tls.Config) {
+				if cfg.ClientAuth != tls.VerifyClientCertIfGiven || cfg.ClientCAs == nil {
+					t.Errorf("ClientAuth = %v, want client certificates verified if given", cfg.ClientAuth)
+				}
+			},
+		},
+		{
+			name:    "required client certificates",
+			options: TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile, ClientAuth: "require"},
+			check: func(t *testing.T, cfg *tls.Config) {
+				if cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+					t.Errorf("ClientAuth = %v, want client certificates required", cfg.ClientAuth)
+				}
+			},
+		},
+		{
+			name:    "unsupported client auth mode",
+			options: TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile, ClientAuth: "maybe"},
+			wantErr: true,
+		},
+		{
+			name:    "client CA bundle without certificates",
+			options: TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: emptyBundle},
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			options: TLSOptions{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.key")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := NewTLSConfig(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTLSConfig() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err == nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
@@ -3,7 +3,7 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -20,16 +20,17 @@ func main() {
 	// Start Task Scheduler
 	w.TaskScheduler, err = gocron.NewScheduler()
 	if err != nil {
-		log.Printf("[ERROR]: could not create task scheduler, reason: %s", err.Error())
+		slog.Error("could not create task scheduler", "reason", err)
 		return
 	}
 	w.TaskScheduler.Start()
-	log.Println("[INFO]: task scheduler has been started")
+	slog.Info("task scheduler has been started")
 
 	if err := w.GenerateOCSPResponderConfig(); err != nil {
-		log.Printf("[ERROR]: could not generate config for OCSP responder: %v", err)
+		slog.Error("could not generate config for OCSP responder", "reason", err)
 		if err := w.StartGenerateOCSPResponderConfigJob(); err != nil {
-			log.Fatalf("[FATAL]: could not start job to generate config for OCSP responder: %v", err)
+			slog.Error("could not start job to generate config for OCSP responder", "reason", err)
+			os.Exit(1)
 		}
 	}
 
@@ -38,7 +39,18 @@ func main() {
 	// Keep the connection alive
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-done
+	failed := false
+	select {
+	case <-done:
+	case <-w.Failed():
+		failed = true
+	}
 
-	w.StopWorker()
+	if err := w.Shutdown(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
 }
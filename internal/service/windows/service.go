@@ -3,7 +3,8 @@
 package main
 
 import (
-	"log"
+	"log/slog"
+	"os"
 
 	"github.com/go-co-op/gocron/v2"
 	"github.com/scncore/scncore-ocsp-responder/internal/common"
@@ -18,19 +19,28 @@ func main() {
 	// Start Task Scheduler
 	w.TaskScheduler, err = gocron.NewScheduler()
 	if err != nil {
-		log.Printf("[ERROR]: could not create task scheduler, reason: %s", err.Error())
+		slog.Error("could not create task scheduler", "reason", err)
 		return
 	}
 	w.TaskScheduler.Start()
-	log.Println("[INFO]: task scheduler has been started")
+	slog.Info("task scheduler has been started")
 
 	if err := w.GenerateOCSPResponderConfig(); err != nil {
-		log.Printf("[ERROR]: could not generate config for OCSP responder: %v", err)
+		slog.Error("could not generate config for OCSP responder", "reason", err)
 		if err := w.StartGenerateOCSPResponderConfigJob(); err != nil {
-			log.Fatalf("[FATAL]: could not start job to generate config for OCSP responder: %v", err)
+			slog.Error("could not start job to generate config for OCSP responder", "reason", err)
+			os.Exit(1)
 		}
 	}
 
+	// The service manager restarts the service if it's set to recover from
+	// failures, which may fix a database that hasn't been migrated yet
+	go func() {
+		<-w.Failed()
+		w.StopWorker()
+		os.Exit(1)
+	}()
+
 	s := utils.NewscncoreWindowsService()
 	s.ServiceStart = w.StartWorker
 	s.ServiceStop = w.StopWorker
@@ -38,6 +48,6 @@ func main() {
 	// Run service
 
 	if err := svc.Run("scncore-ocsp-responder", s); err != nil {
-		log.Printf("[ERROR]: could not run service: %v", err)
+		slog.Error("could not run service", "reason", err)
 	}
 }
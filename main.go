@@ -1,7 +1,7 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"os"
 
 	"github.com/scncore/scncore-ocsp-responder/internal/commands"
@@ -18,7 +18,8 @@ func main() {
 	}
 
 	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+		slog.Error(err.Error())
+		os.Exit(1)
 	}
 }
 
@@ -26,5 +27,21 @@ func getCommands() []*cli.Command {
 	return []*cli.Command{
 		commands.StartOCSPResponder(),
 		commands.StopOCSPResponder(),
+		commands.StatusOCSPResponder(),
+		commands.HealthcheckOCSPResponder(),
+		commands.ValidateConfigOCSPResponder(),
+		commands.CheckOCSPResponder(),
+		commands.InspectOCSPResponder(),
+		commands.GenResponderCertOCSPResponder(),
+		commands.GenSystemdUnitOCSPResponder(),
+		commands.MigrateOCSPResponder(),
+		commands.HistoryOCSPResponder(),
+		commands.AuditOCSPResponder(),
+		commands.RevokeOCSPResponder(),
+		commands.UnrevokeOCSPResponder(),
+		commands.ListOCSPResponder(),
+		commands.ExportOCSPResponder(),
+		commands.ImportOCSPResponder(),
+		commands.ImportCRLOCSPResponder(),
 	}
 }